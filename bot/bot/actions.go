@@ -51,6 +51,15 @@ func (a *Action) validateTimeout(user string, now int64, l *log.Logger) error {
 	return nil
 }
 
+//markCalled updates the global and user timeouts after the action is used.
+func (a *Action) markCalled(user string, now int64) {
+	a.LastCalled = now
+	if a.UserList == nil {
+		a.UserList = make(map[string]int64)
+	}
+	a.UserList[user] = now
+}
+
 func (a *Action) findKeyword(msg string) bool {
 	for _, k := range a.Keywords {
 		if strings.Contains(msg, k) {
@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	auditPrefix = "botaudit-"
+)
+
+//Actions of the audit log.
+const (
+	//A message was deleted and its author penalised by the bot or a moderator
+	auditModeration = "moderation"
+	//A ban of a previous entry was removed
+	auditUnban = "unban"
+	//The chat was locked down because of a raid
+	auditLockdown = "lockdown"
+	//The lockdown was lifted
+	auditLockdownEnd = "lockdownEnd"
+	//Alert for the moderators about a viewer that wrote for the first time
+	auditNewViewer = "newViewer"
+)
+
+var ErrEntryNotFound = errors.New("The audit entry doesnt exists.")
+var ErrNothingToUndo = errors.New("The audit entry has no ban to undo.")
+var ErrAlreadyUndone = errors.New("The audit entry was already undone.")
+
+//AuditEntry records a moderation action.
+//Unban entries reference the entry they undo in Ref, Undone is set on the entries that were undone.
+type AuditEntry struct {
+	Id        int     `json:"id"`
+	Time      int64   `json:"time"`
+	Action    string  `json:"action"`
+	User      string  `json:"user"`
+	MessageId string  `json:"messageId"`
+	Message   string  `json:"message"`
+	Rule      string  `json:"rule"`
+	Penalty   Penalty `json:"penalty"`
+	BanId     string  `json:"banId"`
+	Moderator string  `json:"moderator"`
+	Reason    string  `json:"reason,omitempty"`
+	Ref       int     `json:"ref,omitempty"`
+	Undone    bool    `json:"undone,omitempty"`
+}
+
+//auditLog appends the moderation actions of a bot to its audit file, one JSON entry per line.
+type auditLog struct {
+	mu    sync.Mutex
+	file  string
+	next  int
+	logTo *log.Logger
+}
+
+//loadAuditLog opens the audit log of the bot, the ids continue after the last entry of the file.
+func loadAuditLog(botId string, l *log.Logger) *auditLog {
+	a := &auditLog{file: auditPrefix + botId + suffix, next: 1, logTo: l}
+	entries, err := readAudit(botId)
+	if err != nil {
+		l.Println("Unable to read audit file: " + err.Error())
+		return a
+	}
+	if len(entries) > 0 {
+		a.next = entries[len(entries)-1].Id + 1
+	}
+	return a
+}
+
+//record appends the entry to the audit file and returns it with its id and time.
+func (a *auditLog) record(e AuditEntry) AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e.Id = a.next
+	e.Time = time.Now().Unix()
+	a.next++
+	f, err := os.OpenFile(a.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		a.logTo.Println("Unable to open audit file: " + err.Error())
+		return e
+	}
+	defer f.Close()
+	err = json.NewEncoder(f).Encode(e)
+	if err != nil {
+		a.logTo.Println("Unable to write audit entry: " + err.Error())
+	}
+	return e
+}
+
+//readAudit returns every entry of the audit log of the bot, with Undone set on the entries that were undone.
+func readAudit(botId string) ([]AuditEntry, error) {
+	f, err := os.Open(auditPrefix + botId + suffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []AuditEntry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	res := []AuditEntry{}
+	index := make(map[int]int)
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var e AuditEntry
+		err = dec.Decode(&e)
+		if err != nil {
+			return nil, err
+		}
+		if e.Action == auditUnban {
+			if i, ok := index[e.Ref]; ok {
+				res[i].Undone = true
+			}
+		}
+		index[e.Id] = len(res)
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+//queryAudit returns the entries of the user between from and to, both inclusive.
+//An empty user returns the entries of every user and a to of 0 means there is no upper limit.
+func queryAudit(botId string, user string, from int64, to int64) ([]AuditEntry, error) {
+	entries, err := readAudit(botId)
+	if err != nil {
+		return nil, err
+	}
+	res := []AuditEntry{}
+	for _, e := range entries {
+		if user != "" && e.User != user {
+			continue
+		}
+		if e.Time < from || (to > 0 && e.Time > to) {
+			continue
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+//findAudit returns the entry with the id.
+func findAudit(botId string, id int) (AuditEntry, error) {
+	entries, err := readAudit(botId)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	for _, e := range entries {
+		if e.Id == id {
+			return e, nil
+		}
+	}
+	return AuditEntry{}, ErrEntryNotFound
+}
+
+//lastBan returns the most recent entry of the user with a ban that was not undone.
+func lastBan(botId string, user string) (AuditEntry, error) {
+	entries, err := readAudit(botId)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Action == auditModeration && e.User == user && e.BanId != "" && !e.Undone {
+			return e, nil
+		}
+	}
+	return AuditEntry{}, ErrEntryNotFound
+}
+
+//undo removes the ban of the entry and records it in the audit log.
+func (b *Bot) undo(e AuditEntry, moderator string) (AuditEntry, error) {
+	if e.BanId == "" {
+		return AuditEntry{}, ErrNothingToUndo
+	}
+	if e.Undone {
+		return AuditEntry{}, ErrAlreadyUndone
+	}
+	err := b.unbanFunction(e.BanId)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	b.logTo.Printf("Ban %s of user %s was removed", e.BanId, e.User)
+	return b.audit.record(AuditEntry{Action: auditUnban, User: e.User, BanId: e.BanId, Moderator: moderator, Ref: e.Id}), nil
+}
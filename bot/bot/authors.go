@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	//Seconds an author is remembered after its last message
+	recentAuthorsWindow = 7200
+)
+
+type authorSeen struct {
+	name string
+	last int64
+}
+
+//recentAuthors remembers the display name of the users that wrote in the chat recently,
+//it is used to find the channel id of a user mentioned in a command.
+type recentAuthors struct {
+	mu      sync.Mutex
+	authors map[string]authorSeen
+}
+
+func newRecentAuthors() *recentAuthors {
+	return &recentAuthors{authors: make(map[string]authorSeen)}
+}
+
+func (r *recentAuthors) seen(userId string, name string, now int64) {
+	if userId == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.authors[userId] = authorSeen{name: name, last: now}
+}
+
+//find returns the channel id of the most recent author with the display name provided.
+//The name can start with @ and the comparison ignores case and spaces.
+//An empty string is returned if the author is not found.
+func (r *recentAuthors) find(name string) string {
+	name = normalizeMention(name)
+	if name == "" {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := ""
+	var last int64
+	for id, a := range r.authors {
+		if normalizeMention(a.name) == name && a.last > last {
+			res = id
+			last = a.last
+		}
+	}
+	return res
+}
+
+//name returns the display name of the author or an empty string if it is unknown.
+func (r *recentAuthors) name(userId string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.authors[userId].name
+}
+
+//prune forgets the authors that have not written in the last recentAuthorsWindow seconds.
+func (r *recentAuthors) prune(now int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, a := range r.authors {
+		if now-a.last > recentAuthorsWindow {
+			delete(r.authors, id)
+		}
+	}
+}
+
+func normalizeMention(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+	return strings.ToLower(strings.Join(strings.Fields(name), ""))
+}
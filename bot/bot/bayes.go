@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+)
+
+const (
+	modelPrefix = "botmodel-"
+	//Category of the messages of the chat logs that were not removed
+	categoryOk = "ok"
+	//Prefix of the lines of the chat logs with the text of a message
+	logMessagePrefix = "DisplayMessage: "
+)
+
+//Name of the chat log files created by the loop, the bot id followed by the date.
+var chatLogName = regexp.MustCompile(`^\d{12}\.txt$`)
+
+//Rules of the filters that look at the text of the message, they are the categories of the model.
+//Messages removed by the rate limit, repeat, lockdown, new viewer or manual rules say nothing about their text,
+//and the decisions of the classifier are left out so it doesnt learn from itself.
+var trainingRules = []string{"caps", "words", "links", "maxLength", "symbols", "repeatedChars", "zalgo", "script", "copypasta"}
+
+//BayesCategory has the word counts of the training messages of a category.
+type BayesCategory struct {
+	Docs   int            `json:"docs"`
+	Tokens int            `json:"tokens"`
+	Words  map[string]int `json:"words"`
+}
+
+//BayesModel is a multinomial naive Bayes classifier.
+//The categories are the training rules of the audit log entries plus ok for the messages that were not removed.
+type BayesModel struct {
+	mu         sync.Mutex
+	Categories map[string]*BayesCategory `json:"categories"`
+	Vocabulary int                       `json:"vocabulary"`
+}
+
+func bayesModelFile(botId string, model string) string {
+	if model != "" {
+		return model
+	}
+	return modelPrefix + botId + suffix
+}
+
+func newBayesModel() *BayesModel {
+	return &BayesModel{Categories: make(map[string]*BayesCategory)}
+}
+
+func loadBayesModel(file string) (*BayesModel, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := newBayesModel()
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *BayesModel) save(file string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0666)
+}
+
+//tokens normalizes the text and splits it in words.
+func tokens(text string) []string {
+	return strings.FieldsFunc(utils.Normalize(text, utils.NormalizeStandard), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+//add trains the model with a message of the category.
+func (m *BayesModel) add(category string, text string) {
+	words := tokens(text)
+	if len(words) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.Categories[category]
+	if c == nil {
+		c = &BayesCategory{Words: make(map[string]int)}
+		m.Categories[category] = c
+	}
+	c.Docs++
+	for _, w := range words {
+		if !m.known(w) {
+			m.Vocabulary++
+		}
+		c.Words[w]++
+		c.Tokens++
+	}
+}
+
+//known returns true if any category has the word, it must be called with the lock held.
+func (m *BayesModel) known(w string) bool {
+	for _, c := range m.Categories {
+		if c.Words[w] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//Classify returns the probability of each category for the message, using Laplace smoothing.
+func (m *BayesModel) Classify(in ClassifierInput) (map[string]float64, error) {
+	words := tokens(in.Text)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total := 0
+	for _, c := range m.Categories {
+		total += c.Docs
+	}
+	res := make(map[string]float64, len(m.Categories))
+	if total == 0 {
+		return res, nil
+	}
+	logs := make(map[string]float64, len(m.Categories))
+	max := math.Inf(-1)
+	for name, c := range m.Categories {
+		l := math.Log(float64(c.Docs) / float64(total))
+		for _, w := range words {
+			l += math.Log(float64(c.Words[w]+1) / float64(c.Tokens+m.Vocabulary))
+		}
+		logs[name] = l
+		if l > max {
+			max = l
+		}
+	}
+	sum := 0.0
+	for name, l := range logs {
+		res[name] = math.Exp(l - max)
+		sum += res[name]
+	}
+	for name := range res {
+		res[name] /= sum
+	}
+	return res, nil
+}
+
+//trainBayesModel creates a model from the messages removed in the audit log of the bot by one of the
+//training rules, using the rule as category, and the messages of the chat logs in the directory that
+//were not removed as ok.
+func trainBayesModel(botId string, dir string) (*BayesModel, error) {
+	entries, err := readAudit(botId)
+	if err != nil {
+		return nil, err
+	}
+	m := newBayesModel()
+	removed := make(map[string]bool)
+	for _, e := range entries {
+		if e.Action != auditModeration || e.Message == "" {
+			continue
+		}
+		removed[e.Message] = true
+		if utils.ExistsInSlice(e.Rule, trainingRules) {
+			m.add(e.Rule, e.Message)
+		}
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), botId) || !chatLogName.MatchString(strings.TrimPrefix(f.Name(), botId)) {
+			continue
+		}
+		err = trainFromChatLog(m, filepath.Join(dir, f.Name()), removed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func trainFromChatLog(m *BayesModel, file string, removed map[string]bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		i := strings.Index(line, logMessagePrefix)
+		if i < 0 {
+			continue
+		}
+		text := line[i+len(logMessagePrefix):]
+		if !removed[text] {
+			m.add(categoryOk, text)
+		}
+	}
+	return sc.Err()
+}
+
+//replace sets the counts of the other model, it is used to update the model of a running bot.
+func (m *BayesModel) replace(o *BayesModel) {
+	o.mu.Lock()
+	categories, vocabulary := o.Categories, o.Vocabulary
+	o.mu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Categories = categories
+	m.Vocabulary = vocabulary
+}
+
+//summary returns the number of training messages of each category.
+func (m *BayesModel) summary() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[string]int, len(m.Categories))
+	for name, c := range m.Categories {
+		res[name] = c.Docs
+	}
+	return res
+}
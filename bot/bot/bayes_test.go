@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Buy CHEAP followers!!", []string{"buy", "cheap", "followers"}},
+		{"héllo, wörld 2", []string{"hello", "world", "2"}},
+		{"!!! ...", []string{}},
+	}
+	for _, tt := range tests {
+		if got := tokens(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokens(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func testModel() *BayesModel {
+	m := newBayesModel()
+	for _, s := range []string{"buy cheap followers", "cheap views here", "buy views now"} {
+		m.add("words", s)
+	}
+	for _, s := range []string{"nice play", "hello everyone", "what a game", "gg nice"} {
+		m.add(categoryOk, s)
+	}
+	return m
+}
+
+func TestBayesClassify(t *testing.T) {
+	m := testModel()
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"buy cheap views", "words"},
+		{"CHEAP followers", "words"},
+		{"nice game everyone", categoryOk},
+		{"gg", categoryOk},
+	}
+	for _, tt := range tests {
+		scores, err := m.Classify(ClassifierInput{Text: tt.text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := 0.0
+		best := ""
+		for c, s := range scores {
+			sum += s
+			if best == "" || s > scores[best] {
+				best = c
+			}
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("scores of %q add up to %v", tt.text, sum)
+		}
+		if best != tt.want {
+			t.Errorf("Classify(%q) = %s, want %s (scores %v)", tt.text, best, tt.want, scores)
+		}
+	}
+}
+
+func TestBayesEmptyModel(t *testing.T) {
+	scores, err := newBayesModel().Classify(ClassifierInput{Text: "anything"})
+	if err != nil || len(scores) != 0 {
+		t.Errorf("empty model: got %v %v, want no scores", scores, err)
+	}
+}
+
+func TestBayesSaveAndReplace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bayes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "model.json")
+	m := testModel()
+	if err := m.save(file); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadBayesModel(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newBayesModel()
+	r.replace(loaded)
+	if want := map[string]int{"words": 3, categoryOk: 4}; !reflect.DeepEqual(r.summary(), want) {
+		t.Errorf("summary: got %v, want %v", r.summary(), want)
+	}
+	if r.Vocabulary != m.Vocabulary {
+		t.Errorf("vocabulary: got %d, want %d", r.Vocabulary, m.Vocabulary)
+	}
+}
+
+func TestTrainBayesModel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bayes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	entries := []AuditEntry{
+		{Action: auditModeration, Rule: "words", Message: "buy cheap followers"},
+		{Action: auditModeration, Rule: "links", Message: "visit example dot com"},
+		{Action: auditModeration, Rule: "lockdown", Message: "hello from the raid"},
+		{Action: auditModeration, Rule: "newViewer", Message: "first link here"},
+		{Action: auditModeration, Rule: "classifier.spam", Message: "cheap stuff"},
+		{Action: auditModeration, Rule: "purge"},
+		{Action: auditLockdown, Rule: "raid"},
+	}
+	f, err := os.Create(auditPrefix + "test" + suffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		enc.Encode(e)
+	}
+	f.Close()
+	chatLog := "DisplayMessage: nice play\nDisplayMessage: hello from the raid\nDisplayMessage: buy cheap followers\n"
+	if err := ioutil.WriteFile("test201020261530.txt", []byte(chatLog), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := trainBayesModel("test", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"words": 1, "links": 1, categoryOk: 1}
+	if got := m.summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("categories: got %v, want %v", got, want)
+	}
+}
@@ -1,10 +1,12 @@
 package bot
 
 import (
+	"context"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aiuzu42/aiuzuBot/bot/utils"
@@ -20,14 +22,20 @@ type Bot struct {
 	//The Id of the chat the bot is in.
 	chatId string
 
+	//The id of the live stream the bot was started with, empty for the first live stream of the channel.
+	liveId string
+
+	//The id of the video of the live stream the bot is in.
+	videoId string
+
+	//What the bot did since it was started, shared with the http handlers
+	stats *sessionStats
+
 	//A pointer to a logger
 	logTo *log.Logger
 
-	//Boolean variable to deactive the main loop
-	deactivate bool
-
-	//A variable that indicates that the loop function is alredy running
-	looping bool
+	//Guards the fields used from outside the loop: game, token, config, queueConfig, banLists and classifier
+	mu sync.Mutex
 
 	//A string slice containing a list of admin users id
 	admins []string
@@ -56,59 +64,191 @@ type Bot struct {
 	//Message filters configurations
 	filters Filters
 
-	//Regular expressions used by the bot filters
-	matcher []utils.Matcher
+	//Configuration applied to the bot
+	config LocalConfig
+
+	//Configurations sent by the handlers to be applied by the loop
+	reloads chan reloadRequest
+	//Closed when the loop exits, even if it panicked
+	done chan struct{}
+
+	//Ban lists of the words filter, guarded by mu since the shared lists watcher reads them
+	banLists []BanWords
+
+	//Matcher of the ban lists used by the words filter
+	matcher *utils.Matcher
+
+	//Ban lists shared by every bot
+	shared *sharedLists
+
+	//Logger of the bot handler, used outside of the loop
+	handlerLog *log.Logger
+
+	//Strike history of the viewers, shared with the http handlers
+	strikes *strikeStore
+
+	//Messages caught by the filters in shadow mode, shared with the http handlers
+	shadow *shadowReport
+
+	//Record of every moderation action of the bot
+	audit *auditLog
+
+	moderationConfig ModerationDetails
+
+	//Recent messages of each user, used by the purge command
+	buffer *messageBuffer
+
+	//Filters created from the configuration, in the order they are checked
+	pipeline []Filter
+
+	//Last decisions of the filters, shared with the http handlers
+	decisions *decisionLog
+
+	//Classifier used by the classifier filter, nil if it is not enabled
+	classifier Classifier
+	//End of the time the classifier can use in the current cycle, only used by the loop
+	classifyUntil time.Time
+
+	raidConfig RaidDetails
+	raid       *raidDetector
+
+	welcomeConfig WelcomeDetails
+	//Viewers of the bot across streams, shared with the http handlers
+	viewers *viewerStore
+
+	//One time link passes given with the permit command
+	permits *linkPermits
+
+	//Sliding window of the chat activity used by the spam filters
+	spam *spamDetector
 
 	timed []TimedAction
 
 	onFirstMessages bool
+	//The bot replaces one whose loop panicked, the first and onFirstMessages timed actions were alredy posted
+	restarted bool
 
 	raffle RaffleDetails
+
+	pollConfig PollDetails
+
+	//State of the current poll, shared with the http handlers
+	poll *poll
+
+	pointsConfig PointsDetails
+
+	//Loyalty points of the viewers
+	points *pointsStore
+
+	predictionConfig PredictionDetails
+
+	//State of the current prediction, shared with the http handlers
+	prediction *prediction
+
+	queueConfig QueueDetails
+
+	//Viewers waiting to play with the streamer, shared with the http handlers
+	queue *viewerQueue
+
+	minigameConfig MinigameDetails
+
+	//Engine of the chat minigames
+	minigames *minigames
+
+	//Display names of the users that wrote recently
+	authors *recentAuthors
+
+	gamblingConfig GamblingDetails
+
+	//Pending duels and gambling cooldowns
+	gambling *gambling
 }
 
 //NewBot initializes a Bot struct and sets its values based on the configuration and log provided.
 //It obtains the liveChatId and a refreshToken from the youtube API.
 //If an error ocurrs while obtaining data from the youtube API, an zero value Bot is returned with an error.
-func NewBot(config LocalConfig, liveId string, log *log.Logger) (Bot, error) {
+func NewBot(config LocalConfig, liveId string, shared *sharedLists, log *log.Logger) (*Bot, error) {
 	var chatId string
 	var err error
+	videoId := liveId
+	bot := &Bot{}
+	bot.stats = newSessionStats()
 	if liveId == "" {
-		chatId, err = youtubeapi.GetFristLiveChatIdFromChannelId(config.Configuration.LiveStreamChannelId, config.Configuration.ApiKey, log)
+		videoId, chatId, err = youtubeapi.GetFirstLiveStreamFromChannelId(config.Configuration.LiveStreamChannelId, config.Configuration.ApiKey, log)
+		bot.stats.call(youtubeapi.QuotaSearch, nil)
 	} else {
 		chatId, err = youtubeapi.GetLiveChatIdFromLiveStreamId(liveId, config.Configuration.ApiKey, log)
 	}
+	bot.stats.call(youtubeapi.QuotaList, nil)
 	if err != nil {
 		log.Println("Cant initiate bot since the channel doesnt have an active livestream")
-		return Bot{}, err
+		return nil, err
 	}
-	bot := Bot{}
 	err = bot.refreshToken(config.Configuration.ClientId, config.Configuration.ClientS, config.Configuration.Refresh)
 	if err != nil {
 		log.Println("Cant initiate bot since we are unable to get a new token")
-		return Bot{}, err
+		return nil, err
 	}
 	bot.BotId = config.BotId
 	bot.chatId = chatId
+	bot.liveId = liveId
+	bot.videoId = videoId
 	bot.author = config.Configuration.AuthorId
-	bot.deactivate = false
-	bot.looping = false
 	bot.admins = config.Configuration.Admins
 	bot.timer = 0
 	bot.apiKey = config.Configuration.ApiKey
 	bot.quotes = config.Quotes
 	bot.excluded = config.Configuration.Excluded
 	bot.excluded = append(bot.excluded, bot.author)
+	bot.config = config
+	bot.reloads = make(chan reloadRequest)
+	bot.done = make(chan struct{})
 	bot.filters = config.Filter
+	bot.banLists = config.Filter.Word.BanList
+	bot.strikes = loadStrikeStore(config.BotId, log)
+	bot.shadow = loadShadowReport(config.BotId, log)
+	bot.audit = loadAuditLog(config.BotId, log)
+	bot.moderationConfig = config.Moderation
+	bot.buffer = newMessageBuffer()
+	bot.pipeline = newPipeline(bot.filters)
+	bot.decisions = newDecisionLog()
+	if bot.filters.Classifier.Active {
+		c, errC := newClassifier(config.BotId, bot.filters.Classifier)
+		if errC != nil {
+			log.Println("Unable to create classifier: " + errC.Error())
+		} else {
+			bot.classifier = c
+		}
+	}
+	bot.raidConfig = config.Raid
+	bot.raid = newRaidDetector()
+	bot.welcomeConfig = config.Welcome
+	bot.viewers = loadViewerStore(config.BotId, log)
+	if n := bot.viewers.expire(time.Now().Unix(), config.Viewers.Expire); n > 0 {
+		log.Printf("%d viewers expired", n)
+	}
+	bot.permits = newLinkPermits()
+	bot.spam = newSpamDetector()
 	bot.onFirstMessages = false
 	bot.raffle = config.Raffle
 	bot.raffle.Active = false
-	for _, a := range config.Actions {
-		bot.actions = append(bot.actions,
-			Action{Name: a.Name, Keywords: a.Keywords, Type: a.Type, Message: a.Message, UserTimeout: a.UserTimeout, GlobalTimeout: a.GlobalTimeout, Admin: a.Admin, Uses: a.Uses})
-	}
-	for _, b := range bot.filters.Word.BanList {
-		bot.matcher = append(bot.matcher, utils.NewMatcher(b.Words, bot.logTo))
-	}
+	bot.pollConfig = config.Poll
+	bot.poll = newPoll()
+	bot.pointsConfig = config.Points
+	bot.points = loadPointsStore(config.BotId, log)
+	bot.predictionConfig = config.Prediction
+	bot.prediction = newPrediction()
+	bot.queueConfig = config.Queue
+	bot.queue = newViewerQueue()
+	bot.minigameConfig = config.Minigame
+	bot.minigames = newMinigames(config.Minigame, log)
+	bot.authors = newRecentAuthors()
+	bot.gamblingConfig = config.Gambling
+	bot.gambling = newGambling(config.Gambling)
+	bot.actions = newActions(config.Actions)
+	bot.shared = shared
+	bot.handlerLog = log
+	bot.matcher = utils.NewMatcher(bot.matchLists(), log)
 	now := time.Now().Unix()
 	for _, t := range config.Timed {
 		bot.timed = append(bot.timed, TimedAction{Name: t.Name, Type: t.Type, Cooldown: t.Cooldown, Messages: t.Messages, LastCalled: now})
@@ -116,28 +256,31 @@ func NewBot(config LocalConfig, liveId string, log *log.Logger) (Bot, error) {
 	return bot, nil
 }
 
-//Loop is the main function of the bot, it reads and process comments and handle events.
-//If the function has alredy been called and is looping an error will be returned.
-func (b *Bot) Loop() {
-	if b.looping {
-		return
-	}
-
+//openLog sets the chat log of the bot, a new file named with the bot id and the date.
+//It must be called before the loop starts, the returned file is nil if it cant be opened.
+func (b *Bot) openLog() *os.File {
 	now := time.Now()
 	fileName := b.BotId + now.Format("020120061504") + ".txt"
 	f, errF := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if errF != nil {
 		b.logTo = log.New(os.Stdout, "[aiuzuBot] ", log.LstdFlags)
 		b.logTo.Println("Error reading log file.")
-	} else {
-		defer f.Close()
-		b.logTo = log.New(f, "[aiuzuBot] ", log.LstdFlags)
+		return nil
 	}
+	b.logTo = log.New(f, "[aiuzuBot] ", log.LstdFlags)
+	return f
+}
 
-	b.executeTimed("first")
+//Loop is the main function of the bot, it reads and process comments and handle events
+//until the context is cancelled.
+func (b *Bot) Loop(ctx context.Context) {
+	b.stats.start(time.Now().Unix())
+	defer close(b.done)
+	defer b.cleanup()
+	if !b.restarted {
+		b.executeTimed("first")
+	}
 
-	b.looping = true
-	b.deactivate = false
 	b.onFirstMessages = true
 	tooManyMessages := false
 
@@ -145,12 +288,16 @@ func (b *Bot) Loop() {
 
 	b.timer = time.Now().Unix()
 
-	for !b.deactivate {
+	for ctx.Err() == nil {
+		b.checkReload()
 		tooManyMessages = false
 		m, err := youtubeapi.ReadMessages(b.chatId, next, b.apiKey, b.logTo)
+		b.stats.call(youtubeapi.QuotaReadMessages, err)
 		if err != nil {
 			b.logTo.Println("There was an error attempting to read messages.")
 		} else {
+			b.stats.polled(len(m.Messages), time.Now().Unix())
+			b.classifyUntil = time.Now().Add(classifierCycleBudget)
 			if m.Info.Total > 20 {
 				b.logTo.Println("Too many messages, nothing to do this cycle")
 				tooManyMessages = true
@@ -159,15 +306,50 @@ func (b *Bot) Loop() {
 			if b.raffle.Active {
 				b.endRaffle()
 			}
+			b.endPoll()
+			b.checkPrediction()
+			b.checkMinigame()
+			b.checkDuels()
+			b.authors.prune(time.Now().Unix())
+			b.buffer.prune(time.Now().Unix())
+			b.checkLockdown()
+			b.spam.prune(b.filters.Spam, time.Now().Unix())
 			for _, mi := range m.Messages {
 				logMessage(mi, b.logTo)
+				b.authors.seen(mi.Snippet.Author, mi.AuthorDetails.DisplayName, time.Now().Unix())
+				first, away := b.viewers.seen(mi.Snippet.Author, mi.AuthorDetails, b.chatId, time.Now().Unix())
+				if !b.checkRaid(mi) {
+					continue
+				}
 				if !b.filter(mi) {
 					continue
 				}
-				if tooManyMessages || b.onFirstMessages {
+				b.buffer.add(mi.Snippet.Author, mi.Id, mi.Snippet.DisplayMessage, time.Now().Unix(), b.moderationConfig.Buffer)
+				if b.pointsConfig.Active {
+					b.points.award(mi.Snippet.Author, b.pointsConfig.PerMessage, b.pointsConfig.Cooldown, time.Now().Unix())
+				}
+				if !tooManyMessages && !b.onFirstMessages {
+					b.welcome(mi, first, away)
+				}
+				if b.restricted(mi) {
+					b.holdNewViewer(mi)
+					continue
+				}
+				//The first poll returns the backlog of the chat, its commands were alredy handled
+				if b.onFirstMessages {
+					continue
+				}
+				//Moderation and lockdown commands are still handled when the chat is flooded
+				if b.moderationCommand(mi) {
+					continue
+				}
+				if b.lockdownCommand(mi) {
+					continue
+				}
+				if tooManyMessages {
 					continue
 				}
-				if !b.raffle.Active && strings.HasPrefix(mi.Snippet.DisplayMessage, b.raffle.Command) {
+				if !b.raffle.Active && b.raffle.Command != "" && strings.HasPrefix(mi.Snippet.DisplayMessage, b.raffle.Command) {
 					b.initRaffle(mi)
 					continue
 				}
@@ -175,6 +357,42 @@ func (b *Bot) Loop() {
 					b.addToRaffle(mi.Snippet.Author)
 					continue
 				}
+				if b.pollConfig.Command != "" && strings.HasPrefix(mi.Snippet.DisplayMessage, b.pollConfig.Command) {
+					b.initPoll(mi)
+					continue
+				}
+				if b.poll.vote(mi.Snippet.Author, mi.Snippet.DisplayMessage) {
+					continue
+				}
+				if b.pointsConfig.Active && b.pointsConfig.Command != "" && mi.Snippet.DisplayMessage == b.pointsConfig.Command {
+					b.pointsCommand(mi.Snippet.Author)
+					continue
+				}
+				if b.predictionConfig.Command != "" && strings.HasPrefix(mi.Snippet.DisplayMessage, b.predictionConfig.Command) {
+					b.predictionCommand(mi)
+					continue
+				}
+				if b.predictionConfig.Bet != "" && strings.HasPrefix(mi.Snippet.DisplayMessage, b.predictionConfig.Bet) {
+					b.betCommand(mi)
+					continue
+				}
+				if b.filters.Links.Permit != "" && strings.HasPrefix(mi.Snippet.DisplayMessage, b.filters.Links.Permit+" ") {
+					b.permitCommand(mi)
+					continue
+				}
+				if b.queueCommand(mi) {
+					continue
+				}
+				if b.gamblingCommand(mi) {
+					continue
+				}
+				if b.minigameConfig.Command != "" && strings.HasPrefix(mi.Snippet.DisplayMessage, b.minigameConfig.Command) {
+					b.minigameCommand(mi)
+					continue
+				}
+				if b.minigameAnswer(mi.Snippet.Author, mi.Snippet.DisplayMessage) {
+					continue
+				}
 				for i := range b.actions {
 					if b.actions[i].findKeyword(mi.Snippet.DisplayMessage) {
 						errA := b.executeAction(mi.Snippet.Author, &b.actions[i])
@@ -186,33 +404,87 @@ func (b *Bot) Loop() {
 			}
 		}
 		if b.onFirstMessages {
-			b.executeTimed("onFirstMessages")
+			if !b.restarted {
+				b.executeTimed("onFirstMessages")
+			}
 			b.onFirstMessages = false
 		}
 		b.executeTimed("timed")
-		time.Sleep(10 * time.Second)
+		b.savePoints()
+		b.saveViewers()
+		select {
+		case <-ctx.Done():
+		case req := <-b.reloads:
+			req.result <- b.applyConfig(req.config)
+		case <-time.After(10 * time.Second):
+		}
 	}
 	b.logTo.Println("We are out of the loop")
-	b.deactivate = true
-	b.looping = false
 	b.executeTimed("ending")
 }
 
-//DeactivateLoop stops this bot loop.
-func (b *Bot) DeactivateLoop() {
-	b.logTo.Println("Deactivating loop")
-	b.deactivate = true
-	for b.looping {
-		time.Sleep(1 * time.Second)
-	}
-	b.logTo.Println("Loop deactivated")
+//cleanup closes the event streams, refunds the open bets and saves the state of the bot.
+//It is deferred by Loop so it also runs when the loop panics and the bot is restarted.
+func (b *Bot) cleanup() {
+	b.poll.closeSubscribers()
+	b.refundPrediction(predictionRefunded)
+	b.savePoints()
+	b.saveViewers()
+	b.shadow.persist()
 }
 
 //UpdateGame is used to update the name of the current game in the livestream.
 func (b *Bot) UpdateGame(g string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.game = g
 }
 
+func (b *Bot) currentGame() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.game
+}
+
+func (b *Bot) currentQueueConfig() QueueDetails {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.queueConfig
+}
+
+func (b *Bot) currentClassifier() Classifier {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.classifier
+}
+
+//useTrainedModel replaces the counts of the running bayes classifier with the trained model.
+//If the bot is configured with a bayes classifier but there was no model when it started, the model is installed.
+func (b *Bot) useTrainedModel(m *BayesModel) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if running, ok := b.classifier.(*BayesModel); ok {
+		running.replace(m)
+		return
+	}
+	if b.classifier == nil && b.config.Filter.Classifier.Type == ClassifierBayes {
+		b.classifier = m
+	}
+}
+
+//currentConfig returns the configuration applied to the bot.
+func (b *Bot) currentConfig() LocalConfig {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.config
+}
+
+func (b *Bot) authToken() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.token
+}
+
 func logMessage(m youtubeapi.MessageItem, l *log.Logger) {
 	l.Println("########################################################")
 	l.Println("Author: " + m.Snippet.Author)
@@ -222,6 +494,9 @@ func logMessage(m youtubeapi.MessageItem, l *log.Logger) {
 
 func (b *Bot) postTimedAction() {
 	msg := utils.GetRandomElement(b.quotes)
+	if msg == "" {
+		return
+	}
 	err := b.responseFunction("", msg)
 	if err != nil {
 		b.logTo.Println("Error posting timed action")
@@ -243,11 +518,15 @@ func (b *Bot) refreshToken(clientId string, secret string, refresh string) error
 		}
 
 	}
-	token, err := youtubeapi.GetNewAuthToken(clientId, secret, refresh, b.logTo)
+	token, err := youtubeapi.RequestAuthToken(clientId, secret, refresh, b.logTo)
 	if err != nil {
+		b.stats.call(0, err)
 		return err
 	}
-	b.token = token
+	b.mu.Lock()
+	b.token = token.Token
+	b.mu.Unlock()
+	b.stats.tokenRefreshed(time.Now().Unix() + int64(token.Expiration))
 	return nil
 }
 
@@ -285,39 +564,38 @@ func (b *Bot) executeAction(userId string, a *Action) error {
 		return ErrActionTypeNotFound
 	}
 
-	a.LastCalled = time.Now().Unix()
-	if a.UserList == nil {
-		a.UserList = make(map[string]int64)
-	}
-	a.UserList[userId] = a.LastCalled
+	a.markCalled(userId, time.Now().Unix())
+	b.stats.fired()
 	return nil
 }
 
 //responseFunction is a wrapper function to the PostMessage functionality.
 //It takes as input parameters a userId and a message.
 //This method replaces the bot variables {user} {game} if present with its correspondent values.
-//If the message contains the variable {user} it looks it up in the users table, if its not
-//found it retrieves it with the youtubeapi and updates the table.
+//If the message contains the variable {user} it looks it up in the viewer profiles, if its not
+//found it retrieves it with the youtubeapi and updates the profile.
 //In case PostComment fails due to authorization issues, an attempt is made to refresh the
 //token and if its successful, a second attempt is made to PostComment.
 func (b *Bot) responseFunction(userId string, r string) error {
 	if strings.Contains(r, "{user}") {
-		uname := utils.GetUserName(userId)
+		uname := b.viewers.name(userId)
 		if uname == "" {
 			var errU error
 			uname, errU = youtubeapi.GetUserFromChannelId(userId, b.apiKey, b.logTo)
+			b.stats.call(youtubeapi.QuotaList, errU)
 			if errU != nil {
 				uname = ""
 			} else {
-				utils.AddToUsers(userId, uname)
+				b.viewers.setName(userId, uname)
 			}
 		}
 		r = strings.ReplaceAll(r, "{user}", uname)
 	}
 	if strings.Contains(r, "{game}") {
-		r = strings.ReplaceAll(r, "{game}", b.game)
+		r = strings.ReplaceAll(r, "{game}", b.currentGame())
 	}
-	err := youtubeapi.PostComment(r, b.chatId, b.author, b.apiKey, b.token, b.logTo)
+	err := youtubeapi.PostComment(r, b.chatId, b.author, b.apiKey, b.authToken(), b.logTo)
+	b.stats.call(youtubeapi.QuotaInsert, err)
 	if err != nil && err == youtubeapi.ErrUnauthorized {
 		errR := b.refreshToken("", "", "")
 		if errR != nil {
@@ -325,7 +603,7 @@ func (b *Bot) responseFunction(userId string, r string) error {
 			return err
 		} else {
 			b.logTo.Println("Token refresh succesful")
-			youtubeapi.PostComment(r, b.chatId, b.author, b.apiKey, b.token, b.logTo)
+			b.stats.call(youtubeapi.QuotaInsert, youtubeapi.PostComment(r, b.chatId, b.author, b.apiKey, b.authToken(), b.logTo))
 		}
 	} else if err != nil {
 		return err
@@ -338,7 +616,8 @@ func (b *Bot) responseFunction(userId string, r string) error {
 //In case DeleteCommment fails due to authorization issues, an attempt is made to refresh the
 //token and if its successful, a second attempt is made to DeleteCommment.
 func (b *Bot) deleteFunction(msgId string) error {
-	err := youtubeapi.DeleteCommment(msgId, b.apiKey, b.token, b.logTo)
+	err := youtubeapi.DeleteCommment(msgId, b.apiKey, b.authToken(), b.logTo)
+	b.stats.call(youtubeapi.QuotaDelete, err)
 	if err != nil && err == youtubeapi.ErrUnauthorized {
 		errR := b.refreshToken("", "", "")
 		if errR != nil {
@@ -346,101 +625,113 @@ func (b *Bot) deleteFunction(msgId string) error {
 			return err
 		} else {
 			b.logTo.Println("Token refresh succesful")
-			youtubeapi.DeleteCommment(msgId, b.apiKey, b.token, b.logTo)
+			err = youtubeapi.DeleteCommment(msgId, b.apiKey, b.authToken(), b.logTo)
+			b.stats.call(youtubeapi.QuotaDelete, err)
+			if err == nil {
+				b.stats.deleted()
+			}
 		}
 	} else if err != nil {
 		return err
+	} else {
+		b.stats.deleted()
 	}
 	return nil
 }
 
 //penaltyFunction is a wrapper function to the BanUser functionality.
 //It takes as input parameters a userId to ban, the type t of ban, and a duration d.
-//The banId returned by the api is logged to the the bot logger.
+//The banId returned by the api is logged to the the bot logger and returned so the ban can be undone.
 //If the type is youtubeapi.permanent_ban the duration is not used.
 //In case BanUser fails due to authorization issues, an attempt is made to refresh the
 //token and if its successful, a second attempt is made to BanUser.
-func (b *Bot) penaltyFunction(userId string, t string, d int) error {
-	banId, err := youtubeapi.BanUser(b.chatId, t, userId, d, b.apiKey, b.token, b.logTo)
+func (b *Bot) penaltyFunction(userId string, t string, d int) (string, error) {
+	banId, err := youtubeapi.BanUser(b.chatId, t, userId, d, b.apiKey, b.authToken(), b.logTo)
+	b.stats.call(youtubeapi.QuotaInsert, err)
 	if err != nil && err == youtubeapi.ErrUnauthorized {
 		errR := b.refreshToken("", "", "")
 		if errR != nil {
 			b.logTo.Println("Cant refresh token")
-			return err
+			return "", err
 		} else {
 			b.logTo.Println("Token refresh succesful")
-			banId, _ = youtubeapi.BanUser(b.chatId, t, userId, d, b.apiKey, b.token, b.logTo)
+			banId, err = youtubeapi.BanUser(b.chatId, t, userId, d, b.apiKey, b.authToken(), b.logTo)
+			b.stats.call(youtubeapi.QuotaInsert, err)
+			if err != nil {
+				b.logTo.Println("Cant ban user " + userId)
+				return "", err
+			}
 		}
 	} else if err != nil {
 		b.logTo.Println("Cant ban user " + userId)
-		return err
+		return "", err
 	}
 	b.logTo.Println("User " + userId + " was succesfully banned with banId " + banId)
-	return nil
+	b.stats.banned()
+	return banId, nil
 }
 
-func (b *Bot) filter(msg youtubeapi.MessageItem) bool {
-	res := true
-	if utils.ExistsInSlice(msg.Snippet.Author, b.admins) {
-		return res
-	}
-	if b.filters.Caps.Active {
-		res = utils.ValidateCaps(b.filters.Caps.Percent, b.filters.Caps.Min, msg.Snippet.DisplayMessage)
-		if !res {
-			b.logTo.Printf("Message [%s] didnt pass caps validation", msg.Snippet.DisplayMessage)
-			b.deleteFunction(msg.Id)
-			if b.filters.Caps.Penalty.Type != "" {
-				b.logTo.Printf("A caps penalty was applied for message [%s]", msg.Snippet.DisplayMessage)
-				b.penaltyFunction(msg.Snippet.Author, b.filters.Caps.Penalty.Type, b.filters.Caps.Penalty.Duration)
-			}
-			b.logTo.Printf("A response was send for message [%s]", msg.Snippet.DisplayMessage)
-			b.responseFunction(msg.Snippet.Author, b.filters.Caps.Message)
-			return res
-		}
-	}
-	if b.filters.Word.Active {
-		for i, w := range b.filters.Word.BanList {
-			found := b.matcher[i].Match(msg.Snippet.DisplayMessage)
-			if found {
-				b.logTo.Printf("Message [%s] didnt pass words validation", msg.Snippet.DisplayMessage)
-				b.deleteFunction(msg.Id)
-				if w.Penalty.Type != "" {
-					b.logTo.Printf("A words penalty was applied for message [%s]", msg.Snippet.DisplayMessage)
-					b.penaltyFunction(msg.Snippet.Author, w.Penalty.Type, w.Penalty.Duration)
-				}
-				b.logTo.Printf("A response was send for message [%s]", msg.Snippet.DisplayMessage)
-				b.responseFunction(msg.Snippet.Author, w.Message)
-				return false
-			}
+//unbanFunction is a wrapper function to the UnbanUser functionality.
+//It takes as input parameter the banId returned when the user was banned.
+//In case UnbanUser fails due to authorization issues, an attempt is made to refresh the
+//token and if its successful, a second attempt is made to UnbanUser.
+func (b *Bot) unbanFunction(banId string) error {
+	err := youtubeapi.UnbanUser(banId, b.apiKey, b.authToken(), b.logTo)
+	b.stats.call(youtubeapi.QuotaDelete, err)
+	if err != nil && err == youtubeapi.ErrUnauthorized {
+		errR := b.refreshToken("", "", "")
+		if errR != nil {
+			b.logTo.Println("Cant refresh token")
+			return err
+		} else {
+			b.logTo.Println("Token refresh succesful")
+			err = youtubeapi.UnbanUser(banId, b.apiKey, b.authToken(), b.logTo)
+			b.stats.call(youtubeapi.QuotaDelete, err)
 		}
 	}
-	if b.filters.Max.Active {
-		if len(msg.Snippet.DisplayMessage) >= b.filters.Max.Max {
-			b.logTo.Printf("Message [%s] didnt pass length validation", msg.Snippet.DisplayMessage)
-			b.deleteFunction(msg.Id)
-			if b.filters.Max.Penalty.Type != "" {
-				b.logTo.Printf("A length penalty was applied for message [%s]", msg.Snippet.DisplayMessage)
-				b.penaltyFunction(msg.Snippet.Author, b.filters.Max.Penalty.Type, b.filters.Max.Penalty.Duration)
-			}
-			b.logTo.Printf("A response was send for message [%s]", msg.Snippet.DisplayMessage)
-			b.responseFunction(msg.Snippet.Author, b.filters.Max.Message)
-			return false
+	return err
+}
+
+//matchLists converts the ban lists of the configuration to the lists used by the matcher.
+//The words of the shared categories each list is subscribed to are added to its own words.
+func (b *Bot) matchLists() []utils.MatchList {
+	b.mu.Lock()
+	banLists := b.banLists
+	b.mu.Unlock()
+	res := make([]utils.MatchList, len(banLists))
+	for i, bw := range banLists {
+		words := append([]string{}, bw.Words...)
+		if b.shared != nil {
+			words = append(words, b.shared.words(bw.Categories)...)
 		}
+		res[i] = utils.MatchList{Words: words, Normalization: bw.Normalization, Entries: bw.Entries}
 	}
 	return res
 }
 
+//rebuildMatcher compiles the ban lists again, it is called when a shared list changes.
+func (b *Bot) rebuildMatcher() {
+	b.matcher.Rebuild(b.matchLists(), b.handlerLog)
+}
+
+//postTimed posts one of the messages of a timed action, nothing is posted if it has no messages.
+func (b *Bot) postTimed(messages []string) {
+	if msg := utils.GetRandomElement(messages); msg != "" {
+		b.responseFunction("", msg)
+	}
+}
+
 func (b *Bot) executeTimed(t string) {
 	now := time.Now().Unix()
 	for i := range b.timed {
 		if b.timed[i].Type == t && b.timed[i].Type == "timed" {
 			rem := remainingTimeout(now, b.timed[i].Cooldown, b.timed[i].LastCalled)
 			if rem <= 0 {
-				b.responseFunction("", utils.GetRandomElement(b.timed[i].Messages))
+				b.postTimed(b.timed[i].Messages)
 				b.timed[i].LastCalled = now
 			}
 		} else if b.timed[i].Type == t {
-			b.responseFunction("", utils.GetRandomElement(b.timed[i].Messages))
+			b.postTimed(b.timed[i].Messages)
 			b.timed[i].LastCalled = now
 		}
 	}
@@ -493,6 +784,11 @@ func (b *Bot) endRaffle() {
 	if now < b.raffle.FinishTime {
 		return
 	}
+	if len(b.raffle.Participants) == 0 {
+		b.logTo.Println("The raffle ended without participants")
+		b.raffle.Active = false
+		return
+	}
 	if b.raffle.Winner == "" {
 		b.raffle.Winner = utils.GetRandomElement(b.raffle.Participants)
 	}
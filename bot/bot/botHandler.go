@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -13,13 +15,21 @@ const (
 )
 
 type BotHandler struct {
-	bots     []Bot
+	bots *supervisor
+	//Guards the settings, the handlers run in several goroutines
+	mu       sync.RWMutex
 	settings GlobalConfig
-	logTo    *log.Logger
+	//Modification time of the configuration files applied to the bots
+	configTimes map[string]time.Time
+	logTo       *log.Logger
+	shared      *sharedLists
 }
 
-func NewBotHandler(log *log.Logger) BotHandler {
-	bh := BotHandler{logTo: log, settings: GlobalConfig{}}
+func NewBotHandler(log *log.Logger) *BotHandler {
+	bh := &BotHandler{logTo: log, settings: GlobalConfig{}, configTimes: make(map[string]time.Time)}
+	bh.bots = newSupervisor(log)
+	bh.shared = newSharedLists(sharedListsDir, log)
+	go bh.shared.watch()
 	file, err := os.Open("./")
 	if err != nil {
 		bh.logTo.Println("Error opening directory: " + err.Error())
@@ -45,14 +55,18 @@ func NewBotHandler(log *log.Logger) BotHandler {
 						continue
 					}
 					bh.settings.Global = append(bh.settings.Global, SimpleBotId{BotId: idFromFile, BotType: getBotType(lc.Type)})
+					bh.recordConfigTime(idFromFile)
 				}
 			}
 		}
 	}
+	go bh.watchConfigs()
 	return bh
 }
 
 func (bh *BotHandler) doesBotExists(name string) bool {
+	bh.mu.RLock()
+	defer bh.mu.RUnlock()
 	for _, i := range bh.settings.Global {
 		if i.BotId == name {
 			return true
@@ -62,69 +76,208 @@ func (bh *BotHandler) doesBotExists(name string) bool {
 }
 
 func (bh *BotHandler) updateGame(botId string, game string) error {
-	for i := range bh.bots {
-		if bh.bots[i].BotId == botId {
-			bh.bots[i].game = game
-			return nil
-		}
+	b, err := bh.getRunningBot(botId)
+	if err != nil {
+		return err
 	}
-	return ErrorFindingBot
+	b.UpdateGame(game)
+	return nil
 }
 
 func (bh *BotHandler) getGame(botId string) (string, error) {
-	for i := range bh.bots {
-		if bh.bots[i].BotId == botId {
-			return bh.bots[i].game, nil
-		}
+	b, err := bh.getRunningBot(botId)
+	if err != nil {
+		return "", err
+	}
+	return b.currentGame(), nil
+}
+
+//getRunningBot returns a pointer to the running bot with the provided id.
+func (bh *BotHandler) getRunningBot(botId string) (*Bot, error) {
+	return bh.bots.running(botId)
+}
+
+//getBotState returns the lifecycle state of the bot.
+func (bh *BotHandler) getBotState(botId string) (RunnerStatus, error) {
+	if !bh.doesBotExists(botId) {
+		return RunnerStatus{}, ErrorFindingBot
 	}
-	return "", ErrorFindingBot
+	return bh.bots.status(botId), nil
+}
+
+//getStrikeStore returns the strikes of the bot, if the bot is not running they are loaded from disk.
+func (bh *BotHandler) getStrikeStore(botId string) (*strikeStore, error) {
+	if b, err := bh.getRunningBot(botId); err == nil {
+		return b.strikes, nil
+	}
+	if !bh.doesBotExists(botId) {
+		return nil, ErrorFindingBot
+	}
+	return loadStrikeStore(botId, bh.logTo), nil
+}
+
+//getViewerStore returns the viewer profiles of the bot, if the bot is not running they are loaded from disk.
+func (bh *BotHandler) getViewerStore(botId string) (*viewerStore, error) {
+	if b, err := bh.getRunningBot(botId); err == nil {
+		return b.viewers, nil
+	}
+	if !bh.doesBotExists(botId) {
+		return nil, ErrorFindingBot
+	}
+	return loadViewerStore(botId, bh.logTo), nil
+}
+
+//getShadowReport returns the shadow report of the bot, if the bot is not running it is loaded from disk.
+func (bh *BotHandler) getShadowReport(botId string) (*shadowReport, error) {
+	if b, err := bh.getRunningBot(botId); err == nil {
+		return b.shadow, nil
+	}
+	if !bh.doesBotExists(botId) {
+		return nil, ErrorFindingBot
+	}
+	return loadShadowReport(botId, bh.logTo), nil
+}
+
+//trainClassifier trains the bayes model of the bot from its audit log and chat logs and saves it.
+//If the bot is running with a bayes classifier, or one configured as bayes without a model, the new model is used right away.
+func (bh *BotHandler) trainClassifier(botId string) (map[string]int, error) {
+	if !bh.doesBotExists(botId) {
+		return nil, ErrorFindingBot
+	}
+	lc, err := loadLocalConfig(botId, bh.logTo)
+	if err != nil {
+		return nil, err
+	}
+	m, err := trainBayesModel(botId, ".")
+	if err != nil {
+		bh.logTo.Println("Unable to train classifier: " + err.Error())
+		return nil, err
+	}
+	err = m.save(bayesModelFile(botId, lc.Filter.Classifier.Model))
+	if err != nil {
+		bh.logTo.Println("Unable to save classifier model: " + err.Error())
+		return nil, err
+	}
+	if b, errB := bh.getRunningBot(botId); errB == nil {
+		b.useTrainedModel(m)
+	}
+	bh.logTo.Printf("Classifier of bot %s trained", botId)
+	return m.summary(), nil
 }
 
 func (bh *BotHandler) startBot(botId string, liveId string, game string) error {
+	return bh.launch(botId, liveId, game, false)
+}
+
+//launch starts the bot, if restore is true the runtime state saved at the last shutdown is used.
+func (bh *BotHandler) launch(botId string, liveId string, game string, restore bool) error {
 	bh.logTo.Println("We just enter startBot")
 	if !bh.doesBotExists(botId) {
 		bh.logTo.Println("The bot you want to start does not exists: " + botId)
 		return ErrorFindingBot
 	}
-	for i := range bh.bots {
-		if bh.bots[i].BotId == botId {
-			bh.logTo.Println("Th bot is alredy looping: " + botId)
-			return ErrorBotAlredyExists
+	_, err := bh.bots.start(botId, func() (*Bot, error) {
+		lc, err := loadLocalConfig(botId, bh.logTo)
+		if err != nil {
+			return nil, err
 		}
-	}
-	lc, err := loadLocalConfig(botId, bh.logTo)
-	if err != nil {
-		return err
-	}
-	bot, err := NewBot(lc, liveId, bh.logTo)
+		b, err := NewBot(lc, liveId, bh.shared, bh.logTo)
+		if err != nil {
+			return nil, err
+		}
+		if game != "" {
+			b.UpdateGame(game)
+		}
+		if restore {
+			rs, errR := loadRuntimeState(botId)
+			if errR == nil {
+				b.restoreRuntime(rs)
+			} else if !os.IsNotExist(errR) {
+				bh.logTo.Println("Unable to restore runtime state: " + errR.Error())
+			}
+		}
+		return b, nil
+	})
 	if err != nil {
+		if err == ErrorBotAlredyExists {
+			bh.logTo.Println("Th bot is alredy looping: " + botId)
+		}
 		return err
 	}
-	bh.bots = append(bh.bots, bot)
-	go bh.bots[len(bh.bots)-1].Loop()
+	bh.shared.subscribe(botId, func() {
+		if b, errB := bh.getRunningBot(botId); errB == nil {
+			b.rebuildMatcher()
+		}
+	})
 	bh.logTo.Println("We are about to exit startBot")
-	if game != "" {
-		bh.updateGame(botId, game)
-	}
 	return nil
 }
 
 func (bh *BotHandler) stopBot(botId string) error {
 	bh.logTo.Println("We just enter stopBot")
-	for i := range bh.bots {
-		if bh.bots[i].BotId == botId {
-			bh.bots[i].DeactivateLoop()
-			copy(bh.bots[i:], bh.bots[i+1:])
-			bh.bots = bh.bots[:len(bh.bots)-1]
-			bh.logTo.Println("We are about to exit stopBot")
-			return nil
+	err := bh.bots.stop(botId)
+	if err != nil {
+		return err
+	}
+	bh.shared.unsubscribe(botId)
+	bh.logTo.Println("We are about to exit stopBot")
+	return nil
+}
+
+//Shutdown stops every bot, running their ending actions, and saves the runtime state of the ones
+//that were running and the list of bots to resume on the next start.
+//No bot can be started after it is called.
+func (bh *BotHandler) Shutdown() {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var resume []ResumeEntry
+	for _, id := range bh.bots.shutdown() {
+		b, _ := bh.getRunningBot(id)
+		wg.Add(1)
+		go func(id string, b *Bot) {
+			defer wg.Done()
+			err := bh.stopBot(id)
+			if err != nil || b == nil {
+				return
+			}
+			err = saveRuntimeState(id, b.runtimeState())
+			if err != nil {
+				bh.logTo.Printf("Unable to save runtime state of bot %s: %s", id, err.Error())
+			}
+			mu.Lock()
+			resume = append(resume, ResumeEntry{BotId: id, LiveId: b.liveId, Game: b.currentGame()})
+			mu.Unlock()
+		}(id, b)
+	}
+	wg.Wait()
+	err := saveResumeList(resume)
+	if err != nil {
+		bh.logTo.Println("Unable to save the bots to resume: " + err.Error())
+	}
+	bh.logTo.Printf("%d bots stopped", len(resume))
+}
+
+//Resume starts again the bots that were running when the server was stopped, with their runtime state.
+func (bh *BotHandler) Resume() {
+	entries, err := loadResumeList()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			bh.logTo.Println("Unable to read the bots to resume: " + err.Error())
+		}
+		return
+	}
+	for _, e := range entries {
+		err = bh.launch(e.BotId, e.LiveId, e.Game, true)
+		if err != nil {
+			bh.logTo.Printf("Unable to resume bot %s: %s", e.BotId, err.Error())
 		}
 	}
-	return ErrorFindingBot
 }
 
 func (bh *BotHandler) getSimpleBotList() GlobalConfig {
-	return bh.settings
+	bh.mu.RLock()
+	defer bh.mu.RUnlock()
+	return GlobalConfig{Global: append([]SimpleBotId{}, bh.settings.Global...)}
 }
 
 func (bh *BotHandler) getBotConfiguration(botId string) (LocalConfig, error) {
@@ -140,36 +293,68 @@ func (bh *BotHandler) saveNewConfiguration(lc LocalConfig) error {
 	if err != nil {
 		return err
 	}
+	bh.mu.Lock()
 	bh.settings.Global = append(bh.settings.Global, SimpleBotId{BotId: lc.BotId, BotType: getBotType(lc.Type)})
+	bh.mu.Unlock()
 	return nil
 }
 
 //You cant change the name of a bot
-func (bh *BotHandler) updateConfiguration(lc LocalConfig) error {
+//If the bot is running the configuration is applied to it right away.
+func (bh *BotHandler) updateConfiguration(lc LocalConfig) (ReloadReport, error) {
 	if !bh.doesBotExists(lc.BotId) {
 		bh.logTo.Printf("Bot with name %s does not exists, cant update configuration.", lc.BotId)
-		return ErrorFindingBot
+		return ReloadReport{}, ErrorFindingBot
 	}
 	err := bh.validateAndSaveConfiguration(lc)
 	if err != nil {
-		return err
+		return ReloadReport{}, err
 	}
+	bh.setBotType(lc.BotId, lc.Type)
+	return bh.applyToRunningBot(lc), nil
+}
+
+func (bh *BotHandler) setBotType(botId string, t string) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
 	for i := range bh.settings.Global {
-		if bh.settings.Global[i].BotId == lc.BotId {
-			bh.settings.Global[i].BotType = lc.Type
+		if bh.settings.Global[i].BotId == botId {
+			bh.settings.Global[i].BotType = getBotType(t)
 			break
 		}
 	}
-	return nil
+}
+
+//botIds returns the ids of every bot.
+func (bh *BotHandler) botIds() []string {
+	bh.mu.RLock()
+	defer bh.mu.RUnlock()
+	res := make([]string, len(bh.settings.Global))
+	for i, s := range bh.settings.Global {
+		res[i] = s.BotId
+	}
+	return res
+}
+
+//recordConfigTime saves the modification time of the configuration file of the bot,
+//so the watcher doesnt apply the changes made by the handler again.
+func (bh *BotHandler) recordConfigTime(botId string) {
+	info, err := os.Stat(prefix + botId + suffix)
+	if err != nil {
+		return
+	}
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	bh.configTimes[botId] = info.ModTime()
 }
 
 func (bh *BotHandler) validateAndSaveConfiguration(lc LocalConfig) error {
 	bh.logTo.Printf("Validating bot configuration: [%s]", lc.BotId)
-	if lc.validate(bh.logTo) {
+	if !lc.validate(bh.logTo) {
 		bh.logTo.Println(ErrorValidating.Error())
 		return ErrorValidating
 	}
-	err := bh.writeDataToFile(lc.BotId)
+	err := bh.writeDataToFile(lc)
 	if err != nil {
 		bh.logTo.Println(ErrorSavingConfig.Error())
 		return ErrorSavingConfig
@@ -178,14 +363,19 @@ func (bh *BotHandler) validateAndSaveConfiguration(lc LocalConfig) error {
 	return nil
 }
 
-func (bh *BotHandler) writeDataToFile(name string) error {
-	file, _ := os.OpenFile(prefix+name+suffix, os.O_CREATE, os.ModePerm)
+func (bh *BotHandler) writeDataToFile(lc LocalConfig) error {
+	file, err := os.OpenFile(prefix+lc.BotId+suffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		bh.logTo.Println("Unable to save data.")
+		return err
+	}
 	defer file.Close()
-	err := json.NewEncoder(file).Encode(bh.settings)
+	err = json.NewEncoder(file).Encode(lc)
 	if err != nil {
 		bh.logTo.Println("Unable to save data.")
 		return err
 	}
+	bh.recordConfigTime(lc.BotId)
 	return nil
 }
 
@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+//Types of classifier.
+const (
+	//Naive Bayes model trained from the audit log and the chat logs of the bot
+	ClassifierBayes = "bayes"
+	//Local http service that scores the messages
+	ClassifierHttp = "http"
+)
+
+const (
+	//Milliseconds to wait for the http classifier when the timeout is not configured
+	defaultClassifierTimeout = 500
+	//Time the classifier can use to score the messages of a cycle, so a slow service doesnt stall the bot
+	classifierCycleBudget = 2 * time.Second
+)
+
+var ErrInvalidClassifier = errors.New("The classifier type is not valid.")
+var ErrClassifierResponse = errors.New("The classifier service returned an error.")
+
+//ClassifierInput is the message and the context of its author passed to the classifiers.
+type ClassifierInput struct {
+	Text      string `json:"text"`
+	User      string `json:"user"`
+	Name      string `json:"name"`
+	Member    bool   `json:"member"`
+	Moderator bool   `json:"moderator"`
+	Verified  bool   `json:"verified"`
+}
+
+//Classifier scores a message, it returns a score between 0 and 1 for each of its categories.
+type Classifier interface {
+	Classify(in ClassifierInput) (map[string]float64, error)
+}
+
+//newClassifier creates the classifier of the configuration, the bayes model is loaded from disk.
+func newClassifier(botId string, c ClassifierFilter) (Classifier, error) {
+	switch c.Type {
+	case ClassifierBayes:
+		return loadBayesModel(bayesModelFile(botId, c.Model))
+	case ClassifierHttp:
+		t := c.Timeout
+		if t <= 0 {
+			t = defaultClassifierTimeout
+		}
+		return &httpClassifier{url: c.Url, client: &http.Client{Timeout: time.Duration(t) * time.Millisecond}}, nil
+	}
+	return nil, ErrInvalidClassifier
+}
+
+//httpClassifier sends the input as JSON to a local service that responds with {"scores": {"category": score}}.
+type httpClassifier struct {
+	url    string
+	client *http.Client
+}
+
+type classifierResponse struct {
+	Scores map[string]float64 `json:"scores"`
+}
+
+func (h *httpClassifier) Classify(in ClassifierInput) (map[string]float64, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.client.Post(h.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, ErrClassifierResponse
+	}
+	var cr classifierResponse
+	err = json.NewDecoder(res.Body).Decode(&cr)
+	if err != nil {
+		return nil, err
+	}
+	return cr.Scores, nil
+}
+
+type classifierFilter struct {
+	cfg ClassifierFilter
+}
+
+func newClassifierFilter(f Filters) Filter {
+	if !enabled(f.Classifier.Active, f.Classifier.Mode) {
+		return nil
+	}
+	return &classifierFilter{cfg: f.Classifier}
+}
+
+func (c *classifierFilter) Name() string {
+	return "classifier"
+}
+
+func (c *classifierFilter) Exempt() []string {
+	return c.cfg.Exempt
+}
+
+//Check scores the message and returns the first threshold exceeded, in the order of the configuration.
+//If the classifier fails or the time of the cycle for the classifier is over the message passes the filter.
+func (c *classifierFilter) Check(b *Bot, mi youtubeapi.MessageItem, now int64) (Verdict, bool) {
+	classifier := b.currentClassifier()
+	if classifier == nil {
+		return Verdict{}, false
+	}
+	if !b.classifyUntil.IsZero() && time.Now().After(b.classifyUntil) {
+		b.logTo.Printf("No time left to classify message [%s] in this cycle", mi.Snippet.DisplayMessage)
+		return Verdict{}, false
+	}
+	a := mi.AuthorDetails
+	in := ClassifierInput{Text: mi.Snippet.DisplayMessage, User: mi.Snippet.Author, Name: a.DisplayName, Member: a.IsChatSponsor, Moderator: a.IsChatModerator, Verified: a.IsVerified}
+	scores, err := classifier.Classify(in)
+	if err != nil {
+		b.logTo.Println("Unable to classify message: " + err.Error())
+		return Verdict{}, false
+	}
+	for _, t := range c.cfg.Thresholds {
+		if s, ok := scores[t.Category]; ok && s >= t.Score {
+			return Verdict{Rule: "classifier." + t.Category, Detail: fmt.Sprintf("score %.2f", s), Mode: c.cfg.Mode, Penalty: t.Penalty, Message: t.Message}, true
+		}
+	}
+	return Verdict{}, false
+}
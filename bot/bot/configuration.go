@@ -5,6 +5,8 @@ import (
 	"errors"
 	"log"
 	"os"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
 )
 
 var UnableToLoadConfig = errors.New("Unable to load configuration file.")
@@ -21,19 +23,30 @@ type GlobalConfig struct {
 }
 
 type SimpleBotId struct {
-	BotId   string `json:"botId"`
-	BotType string `json:"type"`
+	BotId   string      `json:"botId"`
+	BotType string      `json:"type"`
+	Summary *BotSummary `json:"summary,omitempty"`
 }
 
 type LocalConfig struct {
-	BotId         string        `json:"botId"`
-	Type          string        `json:"type"`
-	Configuration Configuration `json:"configuration"`
-	Actions       []Action      `json:"actions"`
-	Quotes        []string      `json:"quotes"`
-	Filter        Filters       `json:"filters"`
-	Timed         []TimedAction `json:"timed"`
-	Raffle        RaffleDetails `json:"raffle"`
+	BotId         string            `json:"botId"`
+	Type          string            `json:"type"`
+	Configuration Configuration     `json:"configuration"`
+	Actions       []Action          `json:"actions"`
+	Quotes        []string          `json:"quotes"`
+	Filter        Filters           `json:"filters"`
+	Timed         []TimedAction     `json:"timed"`
+	Raffle        RaffleDetails     `json:"raffle"`
+	Poll          PollDetails       `json:"poll"`
+	Points        PointsDetails     `json:"points"`
+	Prediction    PredictionDetails `json:"prediction"`
+	Queue         QueueDetails      `json:"queue"`
+	Minigame      MinigameDetails   `json:"minigame"`
+	Gambling      GamblingDetails   `json:"gambling"`
+	Moderation    ModerationDetails `json:"moderation"`
+	Raid          RaidDetails       `json:"raid"`
+	Welcome       WelcomeDetails    `json:"welcome"`
+	Viewers       ViewersDetails    `json:"viewers"`
 }
 
 type RaffleDetails struct {
@@ -52,6 +65,153 @@ type RaffleDetails struct {
 	Winner        string   `json:"-"`
 }
 
+type PollDetails struct {
+	Command       string `json:"command"`
+	DefaultTime   int64  `json:"defaultTime"`
+	StartMessage  string `json:"startMessage"`
+	FinishMessage string `json:"finishMessage"`
+}
+
+type PointsDetails struct {
+	Active     bool   `json:"active"`
+	Name       string `json:"name"`
+	PerMessage int64  `json:"perMessage"`
+	Cooldown   int64  `json:"cooldown"`
+	Command    string `json:"command"`
+	Message    string `json:"message"`
+}
+
+type PredictionDetails struct {
+	Command         string `json:"command"`
+	Bet             string `json:"bet"`
+	DefaultTime     int64  `json:"defaultTime"`
+	MinBet          int64  `json:"minBet"`
+	StartMessage    string `json:"startMessage"`
+	LockMessage     string `json:"lockMessage"`
+	ResultMessage   string `json:"resultMessage"`
+	CancelMessage   string `json:"cancelMessage"`
+	NoPointsMessage string `json:"noPointsMessage"`
+}
+
+type QueueDetails struct {
+	Join            string `json:"join"`
+	Leave           string `json:"leave"`
+	Position        string `json:"position"`
+	Next            string `json:"next"`
+	Command         string `json:"command"`
+	MaxSize         int    `json:"maxSize"`
+	MemberPriority  bool   `json:"memberPriority"`
+	JoinMessage     string `json:"joinMessage"`
+	LeaveMessage    string `json:"leaveMessage"`
+	PositionMessage string `json:"positionMessage"`
+	FullMessage     string `json:"fullMessage"`
+	NextMessage     string `json:"nextMessage"`
+	OpenMessage     string `json:"openMessage"`
+	CloseMessage    string `json:"closeMessage"`
+}
+
+type MinigameDetails struct {
+	Command         string   `json:"command"`
+	RoundTime       int64    `json:"roundTime"`
+	Reward          int64    `json:"reward"`
+	Schedule        int64    `json:"schedule"`
+	Games           []string `json:"games"`
+	TriviaPacks     []string `json:"triviaPacks"`
+	Words           []string `json:"words"`
+	QuestionMessage string   `json:"questionMessage"`
+	ScrambleMessage string   `json:"scrambleMessage"`
+	WinnerMessage   string   `json:"winnerMessage"`
+	TimeoutMessage  string   `json:"timeoutMessage"`
+}
+
+type GamblingDetails struct {
+	Active             bool         `json:"active"`
+	MinBet             int64        `json:"minBet"`
+	MaxBet             int64        `json:"maxBet"`
+	Duel               string       `json:"duel"`
+	Accept             string       `json:"accept"`
+	DuelTimeout        int64        `json:"duelTimeout"`
+	DuelCooldown       int64        `json:"duelCooldown"`
+	Slots              string       `json:"slots"`
+	SlotsCooldown      int64        `json:"slotsCooldown"`
+	Symbols            []string     `json:"symbols"`
+	Payouts            []SlotPayout `json:"payouts"`
+	DuelMessage        string       `json:"duelMessage"`
+	DuelWinMessage     string       `json:"duelWinMessage"`
+	DuelExpiredMessage string       `json:"duelExpiredMessage"`
+	SlotsMessage       string       `json:"slotsMessage"`
+	SlotsWinMessage    string       `json:"slotsWinMessage"`
+	NoPointsMessage    string       `json:"noPointsMessage"`
+}
+
+type SlotPayout struct {
+	Symbol     string  `json:"symbol"`
+	Count      int     `json:"count"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+//ModerationDetails configures the moderation commands of the chat.
+//Buffer is the number of recent messages of each user kept to be removed with the purge command.
+type ModerationDetails struct {
+	Timeout ModCommand `json:"timeout"`
+	Ban     ModCommand `json:"ban"`
+	Unban   ModCommand `json:"unban"`
+	Purge   ModCommand `json:"purge"`
+	Buffer  int        `json:"buffer"`
+}
+
+//ModCommand is a moderation command, an empty Command disables it.
+//Roles can contain owner, moderator, member and verified, the admins can always use the command.
+//If Roles is empty only the admins, the moderators and the owner can use it.
+type ModCommand struct {
+	Command string   `json:"command"`
+	Roles   []string `json:"roles"`
+	Message string   `json:"message"`
+}
+
+//RaidDetails configures the detection of raids.
+//A raid is detected when NewChatters users write for the first time, or Similar users send the same text,
+//in Window seconds. During the lockdown the messages of the users that are not members, moderators or
+//regulars are deleted, and the filters are tightened. The lockdown is lifted after Quiet seconds without
+//a raid being detected or when an admin uses Command off, Command on starts it manually.
+//Regulars are the users that wrote before the raid, or that have at least RegularPoints points if it is not 0.
+//The first chatters are not counted during the first Window seconds after the bot starts.
+type RaidDetails struct {
+	Active        bool   `json:"active"`
+	Window        int64  `json:"window"`
+	NewChatters   int    `json:"newChatters"`
+	Similar       int    `json:"similar"`
+	MinLength     int    `json:"minLength"`
+	Quiet         int64  `json:"quiet"`
+	RegularPoints int64  `json:"regularPoints"`
+	Command       string `json:"command"`
+	StartMessage  string `json:"startMessage"`
+	EndMessage    string `json:"endMessage"`
+}
+
+//ViewersDetails configures the viewer profiles.
+//Expire is the number of seconds without writing after which a viewer without notes is forgotten
+//when the bot starts, 0 keeps the viewers forever.
+type ViewersDetails struct {
+	Expire int64 `json:"expire"`
+}
+
+//WelcomeDetails configures the greetings of the viewers.
+//Message is sent to the viewers the first time they write and AlertMessage lets the moderators know about them,
+//it is written to the log and the audit log of the bot, not to the chat.
+//BackMessage is sent to the viewers that write again after BackAfter seconds.
+//During the first Restrict seconds after their first message the new viewers cant use commands,
+//and their messages with links are removed. Moderators and members are not restricted.
+type WelcomeDetails struct {
+	Active          bool   `json:"active"`
+	Message         string `json:"message"`
+	AlertMessage    string `json:"alertMessage"`
+	BackMessage     string `json:"backMessage"`
+	BackAfter       int64  `json:"backAfter"`
+	Restrict        int64  `json:"restrict"`
+	RestrictMessage string `json:"restrictMessage"`
+}
+
 type Configuration struct {
 	ApiKey              string   `json:"apiKey"`
 	Refresh             string   `json:"refresh"`
@@ -63,18 +223,31 @@ type Configuration struct {
 	Excluded            []string `json:"excluded"`
 }
 
+//Filters configures the moderation of the chat.
+//The Mode of each filter can be enforce (default), shadow or off,
+//in shadow mode the messages caught are only recorded in the shadow report.
+//Exempt has the roles that each filter doesnt check: owner, moderator, member or verified.
+//Custom has the settings of the filters added to the registry with RegisterFilter, by filter name.
 type Filters struct {
-	Caps CapsFilter `json:"caps"`
-	Word Words      `json:"words"`
-	Max  MaxLength  `json:"maxLength"`
+	Caps       CapsFilter                 `json:"caps"`
+	Word       Words                      `json:"words"`
+	Links      LinksFilter                `json:"links"`
+	Max        MaxLength                  `json:"maxLength"`
+	Symbols    SymbolsFilter              `json:"symbols"`
+	Classifier ClassifierFilter           `json:"classifier"`
+	Spam       SpamFilter                 `json:"spam"`
+	Strikes    Strikes                    `json:"strikes"`
+	Custom     map[string]json.RawMessage `json:"custom"`
 }
 
 type CapsFilter struct {
-	Min     int     `json:"min"`
-	Percent float64 `json:"percent"`
-	Active  bool    `json:"active"`
-	Penalty Penalty `json:"penalty"`
-	Message string  `json:"message"`
+	Min     int      `json:"min"`
+	Percent float64  `json:"percent"`
+	Active  bool     `json:"active"`
+	Mode    string   `json:"mode"`
+	Exempt  []string `json:"exempt"`
+	Penalty Penalty  `json:"penalty"`
+	Message string   `json:"message"`
 }
 
 type Penalty struct {
@@ -84,20 +257,125 @@ type Penalty struct {
 
 type Words struct {
 	Active  bool       `json:"active"`
+	Mode    string     `json:"mode"`
+	Exempt  []string   `json:"exempt"`
 	BanList []BanWords `json:"banLists"`
 }
 
+//BanWords is a list of banned words.
+//Categories are the names of shared lists whose words are added to the list.
+//Normalization is the level used before matching: none, case, standard (default) or strict.
+//Entries is the type of the words of the list: literal (default), wildcard or regex.
 type BanWords struct {
-	Words   []string `json:"words"`
-	Penalty Penalty  `json:"penalty"`
-	Message string   `json:"message"`
+	Words         []string `json:"words"`
+	Categories    []string `json:"categories"`
+	Normalization string   `json:"normalization"`
+	Entries       string   `json:"entries"`
+	Penalty       Penalty  `json:"penalty"`
+	Message       string   `json:"message"`
+}
+
+//LinksFilter removes the messages with links to domains that are not allowed.
+//Roles can contain owner, moderator, member and verified.
+type LinksFilter struct {
+	Active        bool     `json:"active"`
+	Mode          string   `json:"mode"`
+	Exempt        []string `json:"exempt"`
+	Allowed       []string `json:"allowed"`
+	Roles         []string `json:"roles"`
+	Permit        string   `json:"permit"`
+	PermitTime    int64    `json:"permitTime"`
+	PermitMessage string   `json:"permitMessage"`
+	Message       string   `json:"message"`
+	Penalty       Penalty  `json:"penalty"`
 }
 
+//MaxLength catches the messages with Max or more characters.
 type MaxLength struct {
-	Active  bool    `json:"active"`
-	Max     int     `json:"max"`
-	Message string  `json:"message"`
+	Active  bool     `json:"active"`
+	Mode    string   `json:"mode"`
+	Exempt  []string `json:"exempt"`
+	Max     int      `json:"max"`
+	Message string   `json:"message"`
+	Penalty Penalty  `json:"penalty"`
+}
+
+//SymbolsFilter removes the messages full of emoji, symbols, repeated characters or combining marks.
+//MaxSymbols is the maximum share of symbols and emoji between 0 and 1, MaxRun the longest run of the same
+//character and MaxMarks the maximum number of combining marks per character. A value of 0 disables the check.
+//Scripts restricts the letters of the messages to the unicode scripts provided, like Latin or Cyrillic.
+//Messages shorter than MinLength characters are only checked for combining marks and scripts.
+type SymbolsFilter struct {
+	Active     bool     `json:"active"`
+	Mode       string   `json:"mode"`
+	Exempt     []string `json:"exempt"`
+	MinLength  int      `json:"minLength"`
+	MaxSymbols float64  `json:"maxSymbols"`
+	MaxRun     int      `json:"maxRun"`
+	MaxMarks   float64  `json:"maxMarks"`
+	Scripts    []string `json:"scripts"`
+	Message    string   `json:"message"`
+	Penalty    Penalty  `json:"penalty"`
+}
+
+//SpamFilter detects floods using the recent messages of the chat.
+//Repeat catches a user sending the same or near identical text Count times in Window seconds.
+//Copypasta catches Count different users sending the same text in Window seconds.
+//Rate catches a user sending more than Count messages in Window seconds.
+type SpamFilter struct {
+	Repeat    SpamDetector `json:"repeat"`
+	Copypasta SpamDetector `json:"copypasta"`
+	Rate      SpamDetector `json:"rate"`
+	Exempt    []string     `json:"exempt"`
+}
+
+//SpamDetector is the configuration of one of the spam detectors.
+//Similarity is only used by the repeat detector, a value between 0 and 1 where 0 means identical texts only.
+//Messages shorter than MinLength are ignored by the repeat and copypasta detectors.
+type SpamDetector struct {
+	Active     bool    `json:"active"`
+	Mode       string  `json:"mode"`
+	Window     int64   `json:"window"`
+	Count      int     `json:"count"`
+	Similarity float64 `json:"similarity"`
+	MinLength  int     `json:"minLength"`
+	Message    string  `json:"message"`
+	Penalty    Penalty `json:"penalty"`
+}
+
+//ClassifierFilter scores the messages with a classifier and applies the first threshold exceeded.
+//Type is bayes, a model trained from the audit log saved in Model (botmodel-<botId>.json by default),
+//or http, a local service at Url that must respond in Timeout milliseconds.
+type ClassifierFilter struct {
+	Active     bool                  `json:"active"`
+	Mode       string                `json:"mode"`
+	Exempt     []string              `json:"exempt"`
+	Type       string                `json:"type"`
+	Model      string                `json:"model"`
+	Url        string                `json:"url"`
+	Timeout    int                   `json:"timeout"`
+	Thresholds []ClassifierThreshold `json:"thresholds"`
+}
+
+//ClassifierThreshold is the action taken when the score of the category is at least Score.
+type ClassifierThreshold struct {
+	Category string  `json:"category"`
+	Score    float64 `json:"score"`
+	Message  string  `json:"message"`
+	Penalty  Penalty `json:"penalty"`
+}
+
+//Strikes configures the escalation of penalties for repeat offenders.
+//When active, the penalty of the filters is replaced by the step matching the number of active strikes of the user.
+type Strikes struct {
+	Active bool         `json:"active"`
+	Decay  int64        `json:"decay"`
+	Steps  []StrikeStep `json:"steps"`
+}
+
+type StrikeStep struct {
 	Penalty Penalty `json:"penalty"`
+	Message string  `json:"message"`
 }
 
 type TimedAction struct {
@@ -118,6 +396,34 @@ func (l *LocalConfig) validate(log *log.Logger) bool {
 		log.Println("Mandatory LocalConfig.configuration data missing.")
 		return false
 	}
+	for _, m := range []string{l.Filter.Caps.Mode, l.Filter.Word.Mode, l.Filter.Links.Mode, l.Filter.Max.Mode, l.Filter.Symbols.Mode, l.Filter.Classifier.Mode, l.Filter.Spam.Repeat.Mode, l.Filter.Spam.Copypasta.Mode, l.Filter.Spam.Rate.Mode} {
+		if !validMode(m) {
+			log.Println(prefix + "Invalid filter mode: " + m)
+			return false
+		}
+	}
+	if l.Filter.Classifier.Active && l.Filter.Classifier.Type != ClassifierBayes && l.Filter.Classifier.Type != ClassifierHttp {
+		log.Println(prefix + "Invalid classifier type: " + l.Filter.Classifier.Type)
+		return false
+	}
+	for _, sc := range l.Filter.Symbols.Scripts {
+		if !utils.ValidScript(sc) {
+			log.Println(prefix + "Invalid script in symbols filter: " + sc)
+			return false
+		}
+	}
+	for _, b := range l.Filter.Word.BanList {
+		if !utils.ValidNormalization(b.Normalization) || !utils.ValidEntryType(b.Entries) {
+			log.Println(prefix + "Invalid normalization or entries type in ban list.")
+			return false
+		}
+		for _, c := range b.Categories {
+			if !categoryName.MatchString(c) {
+				log.Println(prefix + "Invalid shared list category in ban list: " + c)
+				return false
+			}
+		}
+	}
 	return true
 }
 
@@ -0,0 +1,333 @@
+package bot
+
+import (
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+const (
+	//Number of filter decisions kept in memory for each bot
+	maxDecisions = 200
+)
+
+//Verdict is the result of a filter that caught a message.
+//Rule identifies what caught the message, it is used by the strikes, the shadow report and the audit log.
+type Verdict struct {
+	Rule    string
+	Detail  string
+	Mode    string
+	Penalty Penalty
+	Message string
+}
+
+//Filter checks the messages of the chat.
+//Filters are created from the configuration by the factories in the filter registry,
+//the bot is passed to Check so the filters dont need to keep a reference to it.
+type Filter interface {
+	//Name of the filter, used in the decisions
+	Name() string
+	//Exempt returns the roles that are not checked by the filter
+	Exempt() []string
+	//Check returns true and the verdict if the message didnt pass the filter
+	Check(b *Bot, mi youtubeapi.MessageItem, now int64) (Verdict, bool)
+}
+
+//FilterFactory creates a filter from the configuration of the bot, it returns nil if the filter is not enabled.
+type FilterFactory func(f Filters) Filter
+
+type registeredFilter struct {
+	name    string
+	factory FilterFactory
+}
+
+var filterRegistry []registeredFilter
+var registryMu sync.Mutex
+
+//RegisterFilter adds a filter to the registry, the filters run in the order they were registered.
+//Custom filters can read their settings from Filters.Custom using their name.
+//It must be called before the bots are started, usually from an init function.
+func RegisterFilter(name string, factory FilterFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for i := range filterRegistry {
+		if filterRegistry[i].name == name {
+			filterRegistry[i].factory = factory
+			return
+		}
+	}
+	filterRegistry = append(filterRegistry, registeredFilter{name: name, factory: factory})
+}
+
+func init() {
+	RegisterFilter("caps", newCapsFilter)
+	RegisterFilter("words", newWordsFilter)
+	RegisterFilter("links", newLinksFilter)
+	RegisterFilter("maxLength", newMaxLengthFilter)
+	RegisterFilter("symbols", newSymbolsFilter)
+	RegisterFilter("spam", newSpamFilter)
+	RegisterFilter("classifier", newClassifierFilter)
+}
+
+//newPipeline creates the enabled filters of the configuration in the order of the registry.
+func newPipeline(f Filters) []Filter {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	var res []Filter
+	for _, r := range filterRegistry {
+		if flt := r.factory(f); flt != nil {
+			res = append(res, flt)
+		}
+	}
+	return res
+}
+
+//Decision records which filter and rule caught a message and what was done with it.
+type Decision struct {
+	Time      int64  `json:"time"`
+	MessageId string `json:"messageId"`
+	User      string `json:"user"`
+	Message   string `json:"message"`
+	Filter    string `json:"filter"`
+	Rule      string `json:"rule"`
+	Detail    string `json:"detail"`
+	Mode      string `json:"mode"`
+}
+
+//decisionLog keeps the last decisions of the filters, shared with the http handlers.
+type decisionLog struct {
+	mu        sync.Mutex
+	decisions []Decision
+}
+
+func newDecisionLog() *decisionLog {
+	return &decisionLog{}
+}
+
+func (d *decisionLog) record(dc Decision) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.decisions = append(d.decisions, dc)
+	if len(d.decisions) > maxDecisions {
+		d.decisions = d.decisions[len(d.decisions)-maxDecisions:]
+	}
+}
+
+//all returns the decisions, if user is not empty only the ones of the user.
+func (d *decisionLog) all(user string) []Decision {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := []Decision{}
+	for _, dc := range d.decisions {
+		if user == "" || dc.User == user {
+			res = append(res, dc)
+		}
+	}
+	return res
+}
+
+//filter runs the message through the pipeline, returns false if the message was removed.
+//The admins are not checked, and each filter skips the authors with one of its exempt roles.
+func (b *Bot) filter(msg youtubeapi.MessageItem) bool {
+	if utils.ExistsInSlice(msg.Snippet.Author, b.admins) {
+		return true
+	}
+	now := time.Now().Unix()
+	for _, f := range b.pipeline {
+		if hasRole(msg.AuthorDetails, f.Exempt()) {
+			continue
+		}
+		v, caught := f.Check(b, msg, now)
+		if !caught {
+			continue
+		}
+		mode := v.Mode
+		if mode == "" {
+			mode = ModeEnforce
+		}
+		b.decisions.record(Decision{Time: now, MessageId: msg.Id, User: msg.Snippet.Author, Message: msg.Snippet.DisplayMessage, Filter: f.Name(), Rule: v.Rule, Detail: v.Detail, Mode: mode})
+		if !b.punish(msg, v) {
+			return false
+		}
+	}
+	return true
+}
+
+type capsFilter struct {
+	cfg CapsFilter
+}
+
+func newCapsFilter(f Filters) Filter {
+	if !enabled(f.Caps.Active, f.Caps.Mode) {
+		return nil
+	}
+	return &capsFilter{cfg: f.Caps}
+}
+
+func (c *capsFilter) Name() string {
+	return "caps"
+}
+
+func (c *capsFilter) Exempt() []string {
+	return c.cfg.Exempt
+}
+
+func (c *capsFilter) Check(b *Bot, mi youtubeapi.MessageItem, now int64) (Verdict, bool) {
+	if utils.ValidateCaps(c.cfg.Percent, c.cfg.Min, mi.Snippet.DisplayMessage) {
+		return Verdict{}, false
+	}
+	return Verdict{Rule: "caps", Mode: c.cfg.Mode, Penalty: c.cfg.Penalty, Message: c.cfg.Message}, true
+}
+
+type wordsFilter struct {
+	cfg Words
+}
+
+func newWordsFilter(f Filters) Filter {
+	if !enabled(f.Word.Active, f.Word.Mode) {
+		return nil
+	}
+	return &wordsFilter{cfg: f.Word}
+}
+
+func (w *wordsFilter) Name() string {
+	return "words"
+}
+
+func (w *wordsFilter) Exempt() []string {
+	return w.cfg.Exempt
+}
+
+func (w *wordsFilter) Check(b *Bot, mi youtubeapi.MessageItem, now int64) (Verdict, bool) {
+	res, found := b.matcher.Match(mi.Snippet.DisplayMessage)
+	if !found || res.List >= len(w.cfg.BanList) {
+		return Verdict{}, false
+	}
+	bw := w.cfg.BanList[res.List]
+	return Verdict{Rule: "words", Detail: "list " + strconv.Itoa(res.List) + " matched [" + res.Term + "]", Mode: w.cfg.Mode, Penalty: bw.Penalty, Message: bw.Message}, true
+}
+
+type linksFilter struct {
+	cfg LinksFilter
+}
+
+func newLinksFilter(f Filters) Filter {
+	if !enabled(f.Links.Active, f.Links.Mode) {
+		return nil
+	}
+	return &linksFilter{cfg: f.Links}
+}
+
+func (l *linksFilter) Name() string {
+	return "links"
+}
+
+func (l *linksFilter) Exempt() []string {
+	return l.cfg.Exempt
+}
+
+func (l *linksFilter) Check(b *Bot, mi youtubeapi.MessageItem, now int64) (Verdict, bool) {
+	if b.validateLinks(mi) {
+		return Verdict{}, false
+	}
+	return Verdict{Rule: "links", Mode: l.cfg.Mode, Penalty: l.cfg.Penalty, Message: l.cfg.Message}, true
+}
+
+type maxLengthFilter struct {
+	cfg MaxLength
+}
+
+func newMaxLengthFilter(f Filters) Filter {
+	if !enabled(f.Max.Active, f.Max.Mode) {
+		return nil
+	}
+	return &maxLengthFilter{cfg: f.Max}
+}
+
+func (m *maxLengthFilter) Name() string {
+	return "maxLength"
+}
+
+func (m *maxLengthFilter) Exempt() []string {
+	return m.cfg.Exempt
+}
+
+func (m *maxLengthFilter) Check(b *Bot, mi youtubeapi.MessageItem, now int64) (Verdict, bool) {
+	if utf8.RuneCountInString(mi.Snippet.DisplayMessage) < m.cfg.Max {
+		return Verdict{}, false
+	}
+	return Verdict{Rule: "maxLength", Mode: m.cfg.Mode, Penalty: m.cfg.Penalty, Message: m.cfg.Message}, true
+}
+
+type symbolsFilter struct {
+	cfg SymbolsFilter
+}
+
+func newSymbolsFilter(f Filters) Filter {
+	if !enabled(f.Symbols.Active, f.Symbols.Mode) {
+		return nil
+	}
+	return &symbolsFilter{cfg: f.Symbols}
+}
+
+func (s *symbolsFilter) Name() string {
+	return "symbols"
+}
+
+func (s *symbolsFilter) Exempt() []string {
+	return s.cfg.Exempt
+}
+
+//Check applies the rules symbols, repeatedChars, zalgo and script in that order.
+func (s *symbolsFilter) Check(b *Bot, mi youtubeapi.MessageItem, now int64) (Verdict, bool) {
+	c := s.cfg
+	msg := mi.Snippet.DisplayMessage
+	st := utils.Chars(msg)
+	rule := ""
+	long := st.Bases >= c.MinLength
+	switch {
+	case long && c.MaxSymbols > 0 && st.Bases > 0 && float64(st.Symbols)/float64(st.Bases) > c.MaxSymbols:
+		rule = "symbols"
+	case long && c.MaxRun > 0 && st.LongestRun > c.MaxRun:
+		rule = "repeatedChars"
+	case c.MaxMarks > 0 && st.Marks > 0 && (st.Bases == 0 || float64(st.Marks)/float64(st.Bases) > c.MaxMarks):
+		rule = "zalgo"
+	case !utils.ScriptsAllowed(msg, c.Scripts):
+		rule = "script"
+	default:
+		return Verdict{}, false
+	}
+	return Verdict{Rule: rule, Mode: c.Mode, Penalty: c.Penalty, Message: c.Message}, true
+}
+
+type spamFilter struct {
+	cfg SpamFilter
+}
+
+func newSpamFilter(f Filters) Filter {
+	sf := f.Spam
+	if !enabled(sf.Repeat.Active, sf.Repeat.Mode) && !enabled(sf.Copypasta.Active, sf.Copypasta.Mode) && !enabled(sf.Rate.Active, sf.Rate.Mode) {
+		return nil
+	}
+	return &spamFilter{cfg: sf}
+}
+
+func (s *spamFilter) Name() string {
+	return "spam"
+}
+
+func (s *spamFilter) Exempt() []string {
+	return s.cfg.Exempt
+}
+
+func (s *spamFilter) Check(b *Bot, mi youtubeapi.MessageItem, now int64) (Verdict, bool) {
+	rule, det := b.spam.check(s.cfg, mi.Snippet.Author, mi.Snippet.DisplayMessage, now)
+	if rule == "" {
+		return Verdict{}, false
+	}
+	return Verdict{Rule: rule, Mode: det.Mode, Penalty: det.Penalty, Message: det.Message}, true
+}
@@ -0,0 +1,200 @@
+package bot
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+type pendingDuel struct {
+	challenger string
+	amount     int64
+	expires    int64
+}
+
+//gambling holds the runtime state of the duels and slots.
+//The cooldowns reuse the Action timeout model, the actions are never executed.
+type gambling struct {
+	duels       map[string]pendingDuel
+	duelAction  Action
+	slotsAction Action
+}
+
+func newGambling(config GamblingDetails) *gambling {
+	return &gambling{
+		duels:       make(map[string]pendingDuel),
+		duelAction:  Action{Name: "duel", UserTimeout: config.DuelCooldown, Uses: -1},
+		slotsAction: Action{Name: "slots", UserTimeout: config.SlotsCooldown, Uses: -1},
+	}
+}
+
+//randomIntn returns a random number in [0, n) from crypto/rand, so the results of the wagers cant be predicted.
+func randomIntn(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic("crypto/rand is not available: " + err.Error())
+	}
+	return int(v.Int64())
+}
+
+//validBet returns true if the amount is inside the configured limits.
+func (b *Bot) validBet(amount int64) bool {
+	if amount <= 0 || amount < b.gamblingConfig.MinBet {
+		return false
+	}
+	return b.gamblingConfig.MaxBet <= 0 || amount <= b.gamblingConfig.MaxBet
+}
+
+//gamblingCommand handles the duel, accept and slots commands.
+//Returns true if the message was a gambling command.
+func (b *Bot) gamblingCommand(mi youtubeapi.MessageItem) bool {
+	gc := b.gamblingConfig
+	msg := strings.TrimSpace(mi.Snippet.DisplayMessage)
+	switch {
+	case gc.Duel != "" && strings.HasPrefix(msg, gc.Duel+" "):
+		if gc.Active {
+			b.duelCommand(mi.Snippet.Author, strings.TrimPrefix(msg, gc.Duel))
+		}
+	case gc.Accept != "" && msg == gc.Accept:
+		if gc.Active {
+			b.acceptDuel(mi.Snippet.Author)
+		}
+	case gc.Slots != "" && strings.HasPrefix(msg, gc.Slots+" "):
+		if gc.Active {
+			b.slotsCommand(mi.Snippet.Author, strings.TrimPrefix(msg, gc.Slots))
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+//duelCommand challenges another user with the format <duel> @user <amount>.
+func (b *Bot) duelCommand(user string, args string) {
+	parts := strings.Fields(args)
+	if len(parts) < 2 {
+		return
+	}
+	amount, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+	if err != nil || !b.validBet(amount) {
+		return
+	}
+	target := b.authors.find(strings.Join(parts[:len(parts)-1], " "))
+	if target == "" || target == user {
+		return
+	}
+	now := time.Now().Unix()
+	if b.gambling.duelAction.validateTimeout(user, now, b.logTo) != nil {
+		return
+	}
+	if b.points.balance(user) < amount {
+		b.gamblingResponse(user, b.gamblingConfig.NoPointsMessage, "", amount)
+		return
+	}
+	if _, ok := b.gambling.duels[target]; ok {
+		return
+	}
+	b.gambling.duelAction.markCalled(user, now)
+	b.gambling.duels[target] = pendingDuel{challenger: user, amount: amount, expires: now + b.gamblingConfig.DuelTimeout}
+	b.logTo.Printf("User %s challenged %s to a duel for %d points", user, target, amount)
+	b.gamblingResponse(target, b.gamblingConfig.DuelMessage, b.authors.name(user), amount)
+}
+
+//acceptDuel resolves the pending duel of the user, the winner is chosen at random.
+func (b *Bot) acceptDuel(user string) {
+	d, ok := b.gambling.duels[user]
+	if !ok {
+		return
+	}
+	delete(b.gambling.duels, user)
+	if time.Now().Unix() > d.expires {
+		return
+	}
+	if b.points.balance(user) < d.amount {
+		b.gamblingResponse(user, b.gamblingConfig.NoPointsMessage, "", d.amount)
+		return
+	}
+	winner, loser := user, d.challenger
+	if randomIntn(2) == 0 {
+		winner, loser = d.challenger, user
+	}
+	err := b.points.transfer(loser, winner, d.amount, "duel")
+	if err != nil {
+		b.logTo.Printf("Duel between %s and %s cancelled: %s", d.challenger, user, err.Error())
+		return
+	}
+	b.logTo.Printf("User %s won a duel against %s for %d points", winner, loser, d.amount)
+	b.gamblingResponse(winner, b.gamblingConfig.DuelWinMessage, b.authors.name(loser), d.amount)
+}
+
+//checkDuels removes the duels that were not accepted in time.
+func (b *Bot) checkDuels() {
+	now := time.Now().Unix()
+	for target, d := range b.gambling.duels {
+		if now > d.expires {
+			delete(b.gambling.duels, target)
+			b.gamblingResponse(d.challenger, b.gamblingConfig.DuelExpiredMessage, b.authors.name(target), d.amount)
+		}
+	}
+}
+
+//slotsCommand spins the slot machine with the format <slots> <amount>.
+//The bet is taken and the payout of the best matching entry of the payout table is given back.
+func (b *Bot) slotsCommand(user string, args string) {
+	amount, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil || !b.validBet(amount) || len(b.gamblingConfig.Symbols) == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	if b.gambling.slotsAction.validateTimeout(user, now, b.logTo) != nil {
+		return
+	}
+	err = b.points.take(user, amount, "slots")
+	if err != nil {
+		b.gamblingResponse(user, b.gamblingConfig.NoPointsMessage, "", amount)
+		return
+	}
+	b.gambling.slotsAction.markCalled(user, now)
+	reels := make([]string, 3)
+	for i := range reels {
+		reels[i] = b.gamblingConfig.Symbols[randomIntn(len(b.gamblingConfig.Symbols))]
+	}
+	payout := int64(float64(amount) * slotsMultiplier(reels, b.gamblingConfig.Payouts))
+	msg := b.gamblingConfig.SlotsMessage
+	if payout > 0 {
+		b.points.add(user, payout, "slots")
+		msg = b.gamblingConfig.SlotsWinMessage
+	}
+	b.logTo.Printf("User %s bet %d points in the slots and won %d", user, amount, payout)
+	b.gamblingResponse(user, strings.ReplaceAll(msg, "{reels}", strings.Join(reels, " ")), "", payout)
+}
+
+//slotsMultiplier returns the highest multiplier of the payouts matched by the reels.
+//A payout matches if its symbol appears at least Count times.
+func slotsMultiplier(reels []string, payouts []SlotPayout) float64 {
+	var res float64
+	for _, p := range payouts {
+		c := 0
+		for _, r := range reels {
+			if r == p.Symbol {
+				c++
+			}
+		}
+		if c >= p.Count && p.Multiplier > res {
+			res = p.Multiplier
+		}
+	}
+	return res
+}
+
+func (b *Bot) gamblingResponse(user string, msg string, other string, amount int64) {
+	if msg == "" {
+		return
+	}
+	msg = strings.ReplaceAll(msg, "{other}", other)
+	b.responseFunction(user, b.replacePoints(msg, amount))
+}
@@ -2,7 +2,9 @@ package bot
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
@@ -16,17 +18,36 @@ func (bh *BotHandler) SimpleBotListEndpoint(w http.ResponseWriter, r *http.Reque
 	if len(gc.Global) < 1 {
 		w.WriteHeader(http.StatusNoContent)
 	} else {
+		for i := range gc.Global {
+			gc.Global[i].Summary = bh.summary(gc.Global[i].BotId)
+		}
 		json.NewEncoder(w).Encode(gc.Global)
 	}
 }
 
+func (bh *BotHandler) GetBotStatusEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	st, err := bh.getBotStatus(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(st)
+}
+
 func (bh *BotHandler) StartBotEndpoint(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	liveId := r.URL.Query().Get("liveId")
 	game := r.URL.Query().Get("game")
 	err := bh.startBot(params["botid"], liveId, game)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		if err == ErrShuttingDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
 		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
 		return
 	}
@@ -79,13 +100,14 @@ func (bh *BotHandler) UpdateBotConfigEndpoint(w http.ResponseWriter, r *http.Req
 		json.NewEncoder(w).Encode(responseError{Message: UnableToDecodeConfig.Error()})
 		return
 	}
-	err = bh.updateConfiguration(lc)
+	report, err := bh.updateConfiguration(lc)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
 		return
 	}
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
 }
 
 func (bh *BotHandler) UpdateBotInfoEndpoint(w http.ResponseWriter, r *http.Request) {
@@ -121,3 +143,471 @@ func (bh *BotHandler) AddNewBotEndpoint(w http.ResponseWriter, r *http.Request)
 	}
 	w.WriteHeader(http.StatusCreated)
 }
+
+func (bh *BotHandler) GetPollEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	b, err := bh.getRunningBot(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(b.poll.results())
+}
+
+//PollStreamEndpoint pushes the poll results as server sent events every time they change.
+func (bh *BotHandler) PollStreamEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	b, err := bh.getRunningBot(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responseError{Message: "Streaming is not supported."})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	updates, cancel := b.poll.subscribe()
+	defer cancel()
+	for {
+		select {
+		case res, open := <-updates:
+			if !open {
+				return
+			}
+			data, errM := json.Marshal(res)
+			if errM != nil {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (bh *BotHandler) GetPredictionEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	b, err := bh.getRunningBot(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(b.prediction.current())
+}
+
+func (bh *BotHandler) GetPointsEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	b, err := bh.getRunningBot(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(b.points.all())
+}
+
+func (bh *BotHandler) UpdatePointsEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	amount, err := strconv.ParseInt(r.URL.Query().Get("amount"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responseError{Message: ErrInvalidAmount.Error()})
+		return
+	}
+	b, err := bh.getRunningBot(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	b.points.set(params["userid"], amount)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (bh *BotHandler) GetQueueEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	b, err := bh.getRunningBot(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(b.queue.status(b.currentQueueConfig().MaxSize))
+}
+
+func (bh *BotHandler) GetLedgerEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	if !bh.doesBotExists(params["botid"]) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: ErrorFindingBot.Error()})
+		return
+	}
+	entries, err := readLedger(params["botid"], r.URL.Query().Get("user"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (bh *BotHandler) GetBotStateEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	st, err := bh.getBotState(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(st)
+}
+
+func (bh *BotHandler) GetStrikesEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	st, err := bh.getStrikeStore(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if params["userid"] != "" {
+		json.NewEncoder(w).Encode(st.get(params["userid"]))
+	} else {
+		json.NewEncoder(w).Encode(st.all())
+	}
+}
+
+func (bh *BotHandler) ClearStrikesEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	st, err := bh.getStrikeStore(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	st.clear(params["userid"])
+	bh.logTo.Printf("Strikes of user %s cleared for bot %s", params["userid"], params["botid"])
+	w.WriteHeader(http.StatusOK)
+}
+
+func (bh *BotHandler) SearchViewersEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	vs, err := bh.getViewerStore(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(vs.search(r.URL.Query().Get("name"), r.URL.Query().Get("role")))
+}
+
+func (bh *BotHandler) GetViewerEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	vs, err := bh.getViewerStore(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	vw, err := vs.get(params["userid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	if st, errS := bh.getStrikeStore(params["botid"]); errS == nil {
+		vw.Strikes = st.get(params["userid"])
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(vw)
+}
+
+func (bh *BotHandler) UpdateViewerEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	var e ViewerEdit
+	err := json.NewDecoder(r.Body).Decode(&e)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	vs, err := bh.getViewerStore(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	vw, err := vs.edit(params["userid"], e)
+	bh.writeViewer(w, vw, err)
+}
+
+func (bh *BotHandler) AddViewerNoteEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	var n Note
+	err := json.NewDecoder(r.Body).Decode(&n)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	vs, err := bh.getViewerStore(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	vw, err := vs.addNote(params["userid"], n)
+	bh.writeViewer(w, vw, err)
+}
+
+func (bh *BotHandler) DeleteViewerEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	vs, err := bh.getViewerStore(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	err = vs.remove(params["userid"])
+	if err != nil {
+		if err == ErrViewerNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	bh.logTo.Printf("Viewer %s removed from bot %s", params["userid"], params["botid"])
+	w.WriteHeader(http.StatusOK)
+}
+
+//writeViewer writes the result of a change to a viewer profile.
+func (bh *BotHandler) writeViewer(w http.ResponseWriter, vw Viewer, err error) {
+	if err != nil {
+		switch err {
+		case ErrViewerNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case ErrEmptyNote:
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(vw)
+}
+
+func (bh *BotHandler) GetBanListsEndpoint(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(bh.shared.categories())
+}
+
+func (bh *BotHandler) GetBanListEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	sl, err := bh.shared.get(params["category"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sl)
+}
+
+func (bh *BotHandler) UpdateBanListEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	var sl SharedList
+	err := json.NewDecoder(r.Body).Decode(&sl)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	sl.Category = params["category"]
+	err = bh.shared.save(sl)
+	if err != nil {
+		if err == ErrInvalidCategory {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (bh *BotHandler) DeleteBanListEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	err := bh.shared.remove(params["category"])
+	if err != nil {
+		if err == ErrInvalidCategory {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (bh *BotHandler) GetShadowReportEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	sr, err := bh.getShadowReport(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sr.all())
+}
+
+func (bh *BotHandler) ClearShadowReportEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	sr, err := bh.getShadowReport(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	sr.clear()
+	bh.logTo.Printf("Shadow report cleared for bot %s", params["botid"])
+	w.WriteHeader(http.StatusOK)
+}
+
+func (bh *BotHandler) GetAuditEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	if !bh.doesBotExists(params["botid"]) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: ErrorFindingBot.Error()})
+		return
+	}
+	q := r.URL.Query()
+	var from, to int64
+	var err error
+	if q.Get("from") != "" {
+		from, err = strconv.ParseInt(q.Get("from"), 10, 64)
+	}
+	if err == nil && q.Get("to") != "" {
+		to, err = strconv.ParseInt(q.Get("to"), 10, 64)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	entries, err := queryAudit(params["botid"], q.Get("user"), from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (bh *BotHandler) UndoAuditEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	b, err := bh.getRunningBot(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	id, err := strconv.Atoi(params["entryid"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	e, err := findAudit(params["botid"], id)
+	if err == nil {
+		e, err = b.undo(e, r.URL.Query().Get("moderator"))
+	}
+	bh.writeUndo(w, e, err)
+}
+
+func (bh *BotHandler) UnbanEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	b, err := bh.getRunningBot(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	e, err := lastBan(params["botid"], params["userid"])
+	if err == nil {
+		e, err = b.undo(e, r.URL.Query().Get("moderator"))
+	}
+	bh.writeUndo(w, e, err)
+}
+
+//writeUndo writes the response of the undo and unban endpoints.
+func (bh *BotHandler) writeUndo(w http.ResponseWriter, e AuditEntry, err error) {
+	if err != nil {
+		switch err {
+		case ErrEntryNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case ErrNothingToUndo, ErrAlreadyUndone:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(e)
+}
+
+func (bh *BotHandler) GetDecisionsEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	b, err := bh.getRunningBot(params["botid"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(b.decisions.all(r.URL.Query().Get("user")))
+}
+
+func (bh *BotHandler) TrainClassifierEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	summary, err := bh.trainClassifier(params["botid"])
+	if err != nil {
+		if err == ErrorFindingBot {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(responseError{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(summary)
+}
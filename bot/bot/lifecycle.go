@@ -0,0 +1,351 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+//States of the lifecycle of a bot.
+const (
+	//The bot is being created, it is connecting to the chat of the stream
+	StateStarting = "starting"
+	//The loop of the bot is running
+	StateRunning = "running"
+	//The loop was asked to stop and is finishing its cycle
+	StateStopping = "stopping"
+	//The loop finished
+	StateStopped = "stopped"
+	//The bot could not be created or its loop panicked, it may be waiting to be restarted
+	StateFailed = "failed"
+)
+
+const (
+	//Restarts allowed after a panic before the bot is left failed
+	maxRestarts = 5
+	//Wait before the first restart, it doubles on each restart
+	restartBackoff = 5 * time.Second
+	//Longest wait between restarts
+	maxRestartBackoff = 5 * time.Minute
+	//A loop that runs this long before panicking starts counting restarts again
+	stableRun = 10 * time.Minute
+)
+
+var ErrBotStopped = errors.New("The bot was stopped while it was starting.")
+var ErrShuttingDown = errors.New("The server is shutting down.")
+
+//LoopPanic is the error of a loop that panicked, Stack is the stack trace of the panic.
+type LoopPanic struct {
+	Value string
+	Stack string
+}
+
+func (p *LoopPanic) Error() string {
+	return "The bot loop panicked: " + p.Value
+}
+
+//RunnerStatus is the lifecycle state of a bot returned by the REST api.
+type RunnerStatus struct {
+	State    string `json:"state"`
+	Error    string `json:"error,omitempty"`
+	Since    int64  `json:"since"`
+	Restarts int    `json:"restarts"`
+	Stack    string `json:"stack,omitempty"`
+}
+
+//botRunner is the lifecycle of a bot:
+//starting -> running -> stopping -> stopped, starting -> failed and running -> failed -> running when it is restarted.
+type botRunner struct {
+	mu       sync.Mutex
+	bot      *Bot
+	state    string
+	err      error
+	since    int64
+	restarts int
+	stack    string
+	cancel   context.CancelFunc
+	//Closed when the runner reaches stopped or failed and it will not be restarted
+	done chan struct{}
+}
+
+//finished returns true if the runner will not run the bot again.
+func (r *botRunner) finished() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+//setState moves the runner to a new state, it must be called with the lock held.
+func (r *botRunner) setState(state string, err error) {
+	r.state = state
+	r.err = err
+	r.since = time.Now().Unix()
+	if p, ok := err.(*LoopPanic); ok {
+		r.stack = p.Stack
+	}
+}
+
+//finish moves the runner to stopped or failed and wakes up the goroutines waiting for it.
+func (r *botRunner) finish(state string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setState(state, err)
+	close(r.done)
+}
+
+//resume runs the bot again after a restart, returns false if the bot was stopped meanwhile.
+func (r *botRunner) resume(b *Bot) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state != StateFailed {
+		return false
+	}
+	r.bot = b
+	r.setState(StateRunning, nil)
+	return true
+}
+
+func (r *botRunner) status() RunnerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := RunnerStatus{State: r.state, Since: r.since, Restarts: r.restarts, Stack: r.stack}
+	if r.err != nil {
+		st.Error = r.err.Error()
+	}
+	return st
+}
+
+//supervisor runs the loops of the bots, each one under its own context and watchdog.
+//It is safe to start, stop and look up bots from several goroutines.
+type supervisor struct {
+	mu      sync.Mutex
+	runners map[string]*botRunner
+	logTo   *log.Logger
+	//Function that runs the bot until the context is cancelled
+	loop func(b *Bot, ctx context.Context)
+	//Function that moves the state of a bot that panicked to the bot created to replace it
+	carry func(old *Bot, b *Bot)
+	//Wait before the first restart of a bot that panicked
+	backoff time.Duration
+	//Set by shutdown, no bot can be started after it
+	closed bool
+}
+
+func newSupervisor(l *log.Logger) *supervisor {
+	return &supervisor{runners: make(map[string]*botRunner), logTo: l, loop: (*Bot).Loop, carry: carryRuntime, backoff: restartBackoff}
+}
+
+//start creates the bot with create and runs its loop in a new goroutine.
+//If the loop panics the bot is created again with create and restarted.
+//Only one runner of a bot can be active, a bot that is stopped or failed can be started again.
+func (s *supervisor) start(botId string, create func() (*Bot, error)) (*Bot, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &botRunner{cancel: cancel, done: make(chan struct{})}
+	r.setState(StateStarting, nil)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		cancel()
+		return nil, ErrShuttingDown
+	}
+	if old, ok := s.runners[botId]; ok && !old.finished() {
+		s.mu.Unlock()
+		cancel()
+		return nil, ErrorBotAlredyExists
+	}
+	s.runners[botId] = r
+	s.mu.Unlock()
+
+	b, err := create()
+	if err != nil {
+		cancel()
+		r.finish(StateFailed, err)
+		return nil, err
+	}
+	f := b.openLog()
+	r.mu.Lock()
+	if r.state != StateStarting {
+		r.mu.Unlock()
+		if f != nil {
+			f.Close()
+		}
+		r.finish(StateStopped, nil)
+		return nil, ErrBotStopped
+	}
+	r.bot = b
+	r.setState(StateRunning, nil)
+	r.mu.Unlock()
+
+	go s.watch(ctx, botId, r, b, f, create)
+	return b, nil
+}
+
+//watch runs the loop of the bot, restarting it with backoff when it panics.
+//After maxRestarts consecutive panics the bot is left failed.
+func (s *supervisor) watch(ctx context.Context, botId string, r *botRunner, b *Bot, f *os.File, create func() (*Bot, error)) {
+	defer r.cancel()
+	restarts := 0
+	for {
+		started := time.Now()
+		err := s.run(ctx, b)
+		if f != nil {
+			f.Close()
+		}
+		if err == nil {
+			r.finish(StateStopped, nil)
+			s.logTo.Printf("Bot %s stopped", botId)
+			return
+		}
+		s.logTo.Printf("Bot %s failed: %s\n%s", botId, err.Error(), err.(*LoopPanic).Stack)
+		if ctx.Err() != nil {
+			r.finish(StateFailed, err)
+			return
+		}
+		if time.Since(started) > stableRun {
+			restarts = 0
+		}
+		old := b
+		b = nil
+		for b == nil {
+			if restarts >= maxRestarts {
+				s.logTo.Printf("Bot %s failed %d times, it will not be restarted", botId, restarts)
+				r.finish(StateFailed, err)
+				return
+			}
+			wait := s.backoff << uint(restarts)
+			if wait > maxRestartBackoff || wait <= 0 {
+				wait = maxRestartBackoff
+			}
+			restarts++
+			r.mu.Lock()
+			if r.state != StateStopping {
+				r.setState(StateFailed, err)
+				r.restarts++
+			}
+			r.mu.Unlock()
+			s.logTo.Printf("Restarting bot %s in %s", botId, wait)
+			select {
+			case <-ctx.Done():
+				r.finish(StateStopped, nil)
+				return
+			case <-time.After(wait):
+			}
+			nb, errC := create()
+			if errC != nil {
+				s.logTo.Printf("Unable to restart bot %s: %s", botId, errC.Error())
+				err = errC
+				continue
+			}
+			b = nb
+		}
+		s.carryState(botId, old, b)
+		f = b.openLog()
+		if !r.resume(b) {
+			if f != nil {
+				f.Close()
+			}
+			r.finish(StateStopped, nil)
+			return
+		}
+		b.logTo.Printf("Bot restarted after a failure: %s", err.Error())
+	}
+}
+
+//run runs the loop of the bot and recovers its panics, so a failing bot doesnt stop the others.
+func (s *supervisor) run(ctx context.Context, b *Bot) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &LoopPanic{Value: fmt.Sprint(p), Stack: string(debug.Stack())}
+			b.logTo.Printf("Recovered from panic: %v\n%s", p, err.(*LoopPanic).Stack)
+		}
+	}()
+	s.loop(b, ctx)
+	return nil
+}
+
+//carryState moves the state of the bot that panicked to the new one.
+//The state of the old bot can be broken by the panic, if it cant be read the new bot starts empty.
+func (s *supervisor) carryState(botId string, old *Bot, b *Bot) {
+	defer func() {
+		if p := recover(); p != nil {
+			s.logTo.Printf("Unable to carry the state of bot %s to the restarted bot: %v", botId, p)
+		}
+	}()
+	s.carry(old, b)
+}
+
+//stop cancels the context of the bot and waits until its loop finishes.
+//A bot waiting to be restarted is not restarted.
+func (s *supervisor) stop(botId string) error {
+	s.mu.Lock()
+	r, ok := s.runners[botId]
+	s.mu.Unlock()
+	if !ok || r.finished() {
+		return ErrorFindingBot
+	}
+	r.mu.Lock()
+	if r.state != StateStopping {
+		r.setState(StateStopping, nil)
+		r.cancel()
+	}
+	r.mu.Unlock()
+	<-r.done
+	return nil
+}
+
+//shutdown stops accepting new bots and returns the bots with a runner that has not finished.
+//Every bot started before it is in the result.
+func (s *supervisor) shutdown() []string {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return s.ids()
+}
+
+//ids returns the bots with a runner that has not finished.
+func (s *supervisor) ids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []string
+	for id, r := range s.runners {
+		if !r.finished() {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+//running returns the bot if its loop is running.
+func (s *supervisor) running(botId string) (*Bot, error) {
+	s.mu.Lock()
+	r, ok := s.runners[botId]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrorFindingBot
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state != StateRunning {
+		return nil, ErrorFindingBot
+	}
+	return r.bot, nil
+}
+
+//status returns the lifecycle state of the bot, a bot that was never started is stopped.
+func (s *supervisor) status(botId string) RunnerStatus {
+	s.mu.Lock()
+	r, ok := s.runners[botId]
+	s.mu.Unlock()
+	if !ok {
+		return RunnerStatus{State: StateStopped}
+	}
+	return r.status()
+}
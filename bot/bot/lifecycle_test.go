@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//newTestSupervisor returns a supervisor that runs loop instead of the loop of the bot.
+//The chat logs of the bots are written in a temporary directory.
+func newTestSupervisor(t *testing.T, loop func(b *Bot, ctx context.Context)) (*supervisor, func() (*Bot, error)) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	s := newSupervisor(log.New(ioutil.Discard, "", 0))
+	s.loop = loop
+	s.carry = func(old *Bot, b *Bot) {
+		b.restarted = true
+	}
+	s.backoff = 10 * time.Millisecond
+	create := func() (*Bot, error) {
+		return &Bot{BotId: filepath.Join(dir, "test")}, nil
+	}
+	return s, create
+}
+
+func waitForState(t *testing.T, s *supervisor, botId string, state string, restarts int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		st := s.status(botId)
+		if st.State == state && st.Restarts == restarts {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("bot %s did not reach %s with %d restarts, status: %+v", botId, state, restarts, s.status(botId))
+}
+
+func TestSupervisorConcurrentStartStop(t *testing.T) {
+	s, create := newTestSupervisor(t, func(b *Bot, ctx context.Context) {
+		<-ctx.Done()
+	})
+	ids := []string{"a", "b", "c"}
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		id := ids[i%len(ids)]
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			s.start(id, create)
+		}()
+		go func() {
+			defer wg.Done()
+			s.stop(id)
+		}()
+		go func() {
+			defer wg.Done()
+			s.status(id)
+			s.running(id)
+			s.ids()
+		}()
+	}
+	wg.Wait()
+	for _, id := range ids {
+		s.stop(id)
+		if st := s.status(id); st.State != StateStopped && st.State != StateFailed {
+			t.Errorf("bot %s is %s after being stopped", id, st.State)
+		}
+	}
+	if running := s.ids(); len(running) != 0 {
+		t.Errorf("bots still running after stop: %v", running)
+	}
+}
+
+func TestSupervisorSingleRunner(t *testing.T) {
+	s, create := newTestSupervisor(t, func(b *Bot, ctx context.Context) {
+		<-ctx.Done()
+	})
+	if _, err := s.start("a", create); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, err := s.start("a", create); err != ErrorBotAlredyExists {
+		t.Errorf("second start: got %v, want %v", err, ErrorBotAlredyExists)
+	}
+	if _, err := s.running("a"); err != nil {
+		t.Errorf("running: %v", err)
+	}
+	if err := s.stop("a"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := s.stop("a"); err != ErrorFindingBot {
+		t.Errorf("second stop: got %v, want %v", err, ErrorFindingBot)
+	}
+	if _, err := s.start("a", create); err != nil {
+		t.Errorf("start after stop: %v", err)
+	}
+	s.stop("a")
+}
+
+func TestSupervisorRestartsAfterPanic(t *testing.T) {
+	var calls int32
+	s, create := newTestSupervisor(t, func(b *Bot, ctx context.Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("boom")
+		}
+		<-ctx.Done()
+	})
+	first, err := s.start("a", create)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	waitForState(t, s, "a", StateRunning, 1)
+	b, err := s.running("a")
+	if err != nil {
+		t.Fatalf("running: %v", err)
+	}
+	if b == first {
+		t.Error("the bot was not created again after the panic")
+	}
+	if !b.restarted {
+		t.Error("the state of the bot that panicked was not carried to the new one")
+	}
+	if st := s.status("a"); st.Error != "" || st.Stack == "" {
+		t.Errorf("unexpected status after restart: %+v", st)
+	}
+	if err := s.stop("a"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if st := s.status("a"); st.State != StateStopped {
+		t.Errorf("state after stop: got %s, want %s", st.State, StateStopped)
+	}
+}
+
+func TestSupervisorCarryPanics(t *testing.T) {
+	var calls int32
+	s, create := newTestSupervisor(t, func(b *Bot, ctx context.Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("boom")
+		}
+		<-ctx.Done()
+	})
+	s.carry = carryRuntime
+	if _, err := s.start("a", create); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	waitForState(t, s, "a", StateRunning, 1)
+	s.stop("a")
+}
+
+func TestSupervisorShutdownRefusesStarts(t *testing.T) {
+	s, create := newTestSupervisor(t, func(b *Bot, ctx context.Context) {
+		<-ctx.Done()
+	})
+	if _, err := s.start("a", create); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	ids := s.shutdown()
+	if len(ids) != 1 || ids[0] != "a" {
+		t.Errorf("shutdown returned %v, want [a]", ids)
+	}
+	if _, err := s.start("b", create); err != ErrShuttingDown {
+		t.Errorf("start after shutdown: got %v, want %v", err, ErrShuttingDown)
+	}
+	s.stop("a")
+}
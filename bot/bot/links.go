@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+const (
+	roleOwner     = "owner"
+	roleModerator = "moderator"
+	roleMember    = "member"
+	roleVerified  = "verified"
+)
+
+//linkPermits keeps the one time link passes given by the moderators.
+type linkPermits struct {
+	mu      sync.Mutex
+	permits map[string]int64
+}
+
+func newLinkPermits() *linkPermits {
+	return &linkPermits{permits: make(map[string]int64)}
+}
+
+func (l *linkPermits) give(user string, expires int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.permits[user] = expires
+}
+
+//use consumes the permit of the user, returns false if the user has no valid permit.
+func (l *linkPermits) use(user string, now int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	exp, ok := l.permits[user]
+	if !ok {
+		return false
+	}
+	delete(l.permits, user)
+	return now <= exp
+}
+
+//hasRole returns true if the author of the message has any of the roles.
+func hasRole(a youtubeapi.AuthorDetails, roles []string) bool {
+	for _, r := range roles {
+		switch r {
+		case roleOwner:
+			if a.IsChatOwner {
+				return true
+			}
+		case roleModerator:
+			if a.IsChatModerator {
+				return true
+			}
+		case roleMember:
+			if a.IsChatSponsor {
+				return true
+			}
+		case roleVerified:
+			if a.IsVerified {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//isModerator returns true if the author is one of the bot admins or a moderator of the chat.
+func (b *Bot) isModerator(mi youtubeapi.MessageItem) bool {
+	return utils.ExistsInSlice(mi.Snippet.Author, b.admins) || mi.AuthorDetails.IsChatModerator || mi.AuthorDetails.IsChatOwner
+}
+
+//validateLinks returns true if the message has no links, all its links are allowed,
+//the author has one of the permitted roles or a permit.
+func (b *Bot) validateLinks(mi youtubeapi.MessageItem) bool {
+	lf := b.filters.Links
+	found := false
+	for _, d := range utils.FindDomains(mi.Snippet.DisplayMessage) {
+		if !utils.DomainAllowed(d, lf.Allowed) {
+			found = true
+			break
+		}
+	}
+	if !found || hasRole(mi.AuthorDetails, lf.Roles) {
+		return true
+	}
+	return b.permits.use(mi.Snippet.Author, time.Now().Unix())
+}
+
+//permitCommand gives a one time link pass to a user with the format <permit> @user.
+func (b *Bot) permitCommand(mi youtubeapi.MessageItem) {
+	if !b.isModerator(mi) {
+		return
+	}
+	target := b.authors.find(strings.TrimPrefix(mi.Snippet.DisplayMessage, b.filters.Links.Permit))
+	if target == "" {
+		return
+	}
+	b.permits.give(target, time.Now().Unix()+b.filters.Links.PermitTime)
+	b.logTo.Printf("User %s gave a link permit to %s", mi.Snippet.Author, target)
+	if b.filters.Links.PermitMessage != "" {
+		b.responseFunction(target, b.filters.Links.PermitMessage)
+	}
+}
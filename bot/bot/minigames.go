@@ -0,0 +1,229 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+const (
+	gameTrivia   = "trivia"
+	gameScramble = "scramble"
+)
+
+var ErrNoRounds = errors.New("The game has no rounds available.")
+var ErrGameNotFound = errors.New("The game is not valid.")
+
+//TriviaQuestion is an entry of a trivia pack file.
+//A trivia pack is a json file containing an array of questions.
+type TriviaQuestion struct {
+	Question string   `json:"question"`
+	Answers  []string `json:"answers"`
+}
+
+//minigame is a chat game that creates rounds with a prompt and the accepted answers.
+type minigame interface {
+	newRound() (string, []string, error)
+}
+
+type triviaGame struct {
+	questions []TriviaQuestion
+}
+
+//loadTrivia reads every trivia pack, the packs that cant be read are skipped.
+func loadTrivia(packs []string, l *log.Logger) *triviaGame {
+	t := &triviaGame{}
+	for _, p := range packs {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			l.Println("Unable to read trivia pack " + p + ": " + err.Error())
+			continue
+		}
+		var q []TriviaQuestion
+		err = json.Unmarshal(data, &q)
+		if err != nil {
+			l.Println("Unable to decode trivia pack " + p + ": " + err.Error())
+			continue
+		}
+		for i := range q {
+			if q[i].Question != "" && len(q[i].Answers) > 0 {
+				t.questions = append(t.questions, q[i])
+			}
+		}
+	}
+	return t
+}
+
+func (t *triviaGame) newRound() (string, []string, error) {
+	if len(t.questions) == 0 {
+		return "", nil, ErrNoRounds
+	}
+	q := t.questions[rand.Intn(len(t.questions))]
+	return q.Question, q.Answers, nil
+}
+
+type scrambleGame struct {
+	words []string
+}
+
+func (s *scrambleGame) newRound() (string, []string, error) {
+	if len(s.words) == 0 {
+		return "", nil, ErrNoRounds
+	}
+	w := s.words[rand.Intn(len(s.words))]
+	return scramble(w), []string{w}, nil
+}
+
+//scramble shuffles the letters of the word, it tries a few times to get a result different from the word.
+func scramble(w string) string {
+	r := []rune(w)
+	for i := 0; i < 5; i++ {
+		rand.Shuffle(len(r), func(i, j int) { r[i], r[j] = r[j], r[i] })
+		if string(r) != w {
+			break
+		}
+	}
+	return string(r)
+}
+
+//minigames is the engine that runs the rounds of the chat games.
+//Only one round can be active at the same time.
+type minigames struct {
+	games     map[string]minigame
+	active    string
+	prompt    string
+	answers   []string
+	endTime   int64
+	nextRound int64
+}
+
+func newMinigames(config MinigameDetails, l *log.Logger) *minigames {
+	m := &minigames{games: make(map[string]minigame)}
+	m.games[gameTrivia] = loadTrivia(config.TriviaPacks, l)
+	m.games[gameScramble] = &scrambleGame{words: config.Words}
+	if config.Schedule > 0 {
+		m.nextRound = time.Now().Unix() + config.Schedule
+	}
+	return m
+}
+
+//start begins a new round of the game.
+func (m *minigames) start(game string, roundTime int64) error {
+	g, ok := m.games[game]
+	if !ok {
+		return ErrGameNotFound
+	}
+	prompt, answers, err := g.newRound()
+	if err != nil {
+		return err
+	}
+	m.active = game
+	m.prompt = prompt
+	m.answers = answers
+	m.endTime = time.Now().Unix() + roundTime
+	return nil
+}
+
+func (m *minigames) stop() {
+	m.active = ""
+	m.prompt = ""
+	m.answers = nil
+}
+
+//isAnswer returns true if the message is one of the accepted answers of the active round.
+func (m *minigames) isAnswer(msg string) bool {
+	msg = strings.TrimSpace(msg)
+	for _, a := range m.answers {
+		if strings.EqualFold(a, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+//minigameCommand handles the admin command to start or stop a game:
+//<command> trivia|scramble|stop
+func (b *Bot) minigameCommand(mi youtubeapi.MessageItem) {
+	if !utils.ExistsInSlice(mi.Snippet.Author, b.admins) {
+		return
+	}
+	game := strings.TrimSpace(strings.TrimPrefix(mi.Snippet.DisplayMessage, b.minigameConfig.Command))
+	if game == "stop" {
+		b.logTo.Printf("User %s stopped the game", mi.Snippet.Author)
+		b.minigames.stop()
+		return
+	}
+	if b.minigames.active != "" {
+		return
+	}
+	b.startMinigame(game)
+}
+
+func (b *Bot) startMinigame(game string) {
+	err := b.minigames.start(game, b.minigameConfig.RoundTime)
+	if err != nil {
+		b.logTo.Printf("Unable to start game %s: %s", game, err.Error())
+		return
+	}
+	b.logTo.Printf("A %s round started", game)
+	msg := b.minigameConfig.QuestionMessage
+	if game == gameScramble {
+		msg = b.minigameConfig.ScrambleMessage
+	}
+	msg = strings.ReplaceAll(msg, "{question}", b.minigames.prompt)
+	msg = strings.ReplaceAll(msg, "{word}", b.minigames.prompt)
+	if msg != "" {
+		b.responseFunction("", msg)
+	}
+}
+
+//minigameAnswer sends the message to the active round.
+//Returns true if the message is a correct answer, in that case it must not be used by other commands.
+func (b *Bot) minigameAnswer(user string, msg string) bool {
+	if b.minigames.active == "" || !b.minigames.isAnswer(msg) {
+		return false
+	}
+	answer := b.minigames.answers[0]
+	b.minigames.stop()
+	b.logTo.Printf("User %s won the round with the answer [%s]", user, answer)
+	if b.minigameConfig.Reward > 0 {
+		b.points.add(user, b.minigameConfig.Reward, "minigame")
+	}
+	r := strings.ReplaceAll(b.minigameConfig.WinnerMessage, "{answer}", answer)
+	r = strings.ReplaceAll(r, "{points}", strconv.FormatInt(b.minigameConfig.Reward, 10))
+	r = strings.ReplaceAll(r, "{pointsName}", b.pointsConfig.Name)
+	if r != "" {
+		b.responseFunction(user, r)
+	}
+	return true
+}
+
+//checkMinigame finishes the active round if its time is over and starts the scheduled rounds.
+func (b *Bot) checkMinigame() {
+	now := time.Now().Unix()
+	if b.minigames.active != "" {
+		if now < b.minigames.endTime {
+			return
+		}
+		answer := b.minigames.answers[0]
+		b.minigames.stop()
+		b.logTo.Println("The round finished without a winner")
+		if b.minigameConfig.TimeoutMessage != "" {
+			b.responseFunction("", strings.ReplaceAll(b.minigameConfig.TimeoutMessage, "{answer}", answer))
+		}
+		return
+	}
+	if b.minigameConfig.Schedule <= 0 || len(b.minigameConfig.Games) == 0 || now < b.minigames.nextRound {
+		return
+	}
+	b.minigames.nextRound = now + b.minigameConfig.Schedule
+	b.startMinigame(utils.GetRandomElement(b.minigameConfig.Games))
+}
@@ -0,0 +1,176 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+const (
+	//Messages of each user kept when the buffer size is not configured
+	defaultModerationBuffer = 20
+	penaltyTemporary        = "temporary"
+	penaltyPermanent        = "permanent"
+)
+
+type bufferedMessage struct {
+	id   string
+	text string
+	time int64
+}
+
+//messageBuffer keeps the recent messages of each user so a moderator can remove them with the purge command.
+type messageBuffer struct {
+	mu   sync.Mutex
+	msgs map[string][]bufferedMessage
+}
+
+func newMessageBuffer() *messageBuffer {
+	return &messageBuffer{msgs: make(map[string][]bufferedMessage)}
+}
+
+//add keeps the message, only the last size messages of the user are kept.
+func (m *messageBuffer) add(user string, id string, text string, now int64, size int) {
+	if size <= 0 {
+		size = defaultModerationBuffer
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msgs := append(m.msgs[user], bufferedMessage{id: id, text: text, time: now})
+	if len(msgs) > size {
+		msgs = msgs[len(msgs)-size:]
+	}
+	m.msgs[user] = msgs
+}
+
+//take removes and returns the buffered messages of the user.
+func (m *messageBuffer) take(user string) []bufferedMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msgs := m.msgs[user]
+	delete(m.msgs, user)
+	return msgs
+}
+
+//prune forgets the users that have not written in the last recentAuthorsWindow seconds.
+func (m *messageBuffer) prune(now int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for u, msgs := range m.msgs {
+		if len(msgs) == 0 || now-msgs[len(msgs)-1].time > recentAuthorsWindow {
+			delete(m.msgs, u)
+		}
+	}
+}
+
+//canModerate returns true if the author of the message is allowed to use a moderation command with the roles.
+func (b *Bot) canModerate(mi youtubeapi.MessageItem, roles []string) bool {
+	if utils.ExistsInSlice(mi.Snippet.Author, b.admins) {
+		return true
+	}
+	if len(roles) == 0 {
+		return b.isModerator(mi)
+	}
+	return hasRole(mi.AuthorDetails, roles)
+}
+
+//moderationCommand handles the commands <timeout> @user seconds [reason], <ban> @user [reason],
+//<unban> @user and <purge> @user. The target is searched in the recent authors by its display name,
+//which can have spaces.
+//Returns true if the message was a moderation command.
+func (b *Bot) moderationCommand(mi youtubeapi.MessageItem) bool {
+	mc := b.moderationConfig
+	parts := strings.Fields(mi.Snippet.DisplayMessage)
+	if len(parts) == 0 {
+		return false
+	}
+	kinds := []string{"timeout", "ban", "unban", "purge"}
+	var kind string
+	var cmd ModCommand
+	for i, c := range []ModCommand{mc.Timeout, mc.Ban, mc.Unban, mc.Purge} {
+		if c.Command != "" && parts[0] == c.Command {
+			kind, cmd = kinds[i], c
+			break
+		}
+	}
+	if kind == "" {
+		return false
+	}
+	mod := mi.Snippet.Author
+	if !b.canModerate(mi, cmd.Roles) {
+		b.logTo.Printf("User %s is not allowed to use the %s command", mod, kind)
+		return true
+	}
+	if len(parts) < 2 {
+		return true
+	}
+	target, args := b.findTarget(parts[1:])
+	if target == "" {
+		b.logTo.Printf("User %s used the %s command with an unknown user %s", mod, kind, strings.Join(parts[1:], " "))
+		return true
+	}
+	if target == mod || utils.ExistsInSlice(target, b.admins) {
+		b.logTo.Printf("User %s cant use the %s command on %s", mod, kind, target)
+		return true
+	}
+	var err error
+	switch kind {
+	case "timeout":
+		if len(args) == 0 {
+			return true
+		}
+		d, errA := strconv.Atoi(args[0])
+		if errA != nil || d <= 0 {
+			return true
+		}
+		err = b.manualPenalty(mod, target, kind, Penalty{Type: penaltyTemporary, Duration: d}, strings.Join(args[1:], " "))
+	case "ban":
+		err = b.manualPenalty(mod, target, kind, Penalty{Type: penaltyPermanent}, strings.Join(args, " "))
+	case "unban":
+		var e AuditEntry
+		e, err = lastBan(b.BotId, target)
+		if err == nil {
+			_, err = b.undo(e, mod)
+		}
+	case "purge":
+		msgs := b.buffer.take(target)
+		for _, m := range msgs {
+			b.deleteFunction(m.id)
+			b.audit.record(AuditEntry{Action: auditModeration, User: target, MessageId: m.id, Message: m.text, Rule: kind, Moderator: mod})
+		}
+		b.logTo.Printf("User %s purged %d messages of %s", mod, len(msgs), target)
+	}
+	if err != nil {
+		b.logTo.Printf("The %s command of %s on %s failed: %s", kind, mod, target, err.Error())
+		return true
+	}
+	if cmd.Message != "" {
+		b.responseFunction(target, cmd.Message)
+	}
+	return true
+}
+
+//findTarget returns the recent author whose display name is the longest match of the first words,
+//and the words after the name. The user is empty if no name matches.
+func (b *Bot) findTarget(words []string) (string, []string) {
+	for i := len(words); i > 0; i-- {
+		if target := b.authors.find(strings.Join(words[:i], " ")); target != "" {
+			return target, words[i:]
+		}
+	}
+	return "", nil
+}
+
+//manualPenalty bans the user on behalf of a moderator and records it in the audit log.
+func (b *Bot) manualPenalty(mod string, user string, rule string, p Penalty, reason string) error {
+	banId, err := b.penaltyFunction(user, p.Type, p.Duration)
+	if err != nil {
+		return err
+	}
+	b.logTo.Printf("User %s applied a %s penalty to %s", mod, rule, user)
+	b.audit.record(AuditEntry{Action: auditModeration, User: user, Rule: rule, Penalty: p, BanId: banId, Moderator: mod, Reason: reason})
+	return nil
+}
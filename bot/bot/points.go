@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pointsPrefix = "botpoints-"
+	ledgerPrefix = "botledger-"
+)
+
+var ErrNotEnoughPoints = errors.New("Not enough points.")
+var ErrInvalidAmount = errors.New("The amount is not valid.")
+
+//LedgerEntry records a movement of points between two users.
+//An empty From or To means the points came from or went to the bot.
+type LedgerEntry struct {
+	Time   int64  `json:"time"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int64  `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+//pointsStore keeps the loyalty points balance of every viewer of a bot.
+//The balances are saved to disk so they are kept between streams, every movement
+//of points except the ones earned by chatting is appended to the ledger file.
+type pointsStore struct {
+	mu         sync.Mutex
+	file       string
+	ledgerFile string
+	balances   map[string]int64
+	lastAward  map[string]int64
+	dirty      bool
+	logTo      *log.Logger
+}
+
+//loadPointsStore reads the points file of the bot, if the file doesnt exists an empty store is returned.
+func loadPointsStore(botId string, l *log.Logger) *pointsStore {
+	p := &pointsStore{file: pointsPrefix + botId + suffix, ledgerFile: ledgerPrefix + botId + suffix, balances: make(map[string]int64), lastAward: make(map[string]int64), logTo: l}
+	data, err := ioutil.ReadFile(p.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.Println("Unable to read points file: " + err.Error())
+		}
+		return p
+	}
+	err = json.Unmarshal(data, &p.balances)
+	if err != nil {
+		l.Println("Unable to decode points file: " + err.Error())
+		p.balances = make(map[string]int64)
+	}
+	return p
+}
+
+//save writes the balances to disk if they changed since the last save.
+func (p *pointsStore) save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.dirty {
+		return nil
+	}
+	data, err := json.Marshal(p.balances)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(p.file, data, 0666)
+	if err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
+
+func (p *pointsStore) balance(user string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.balances[user]
+}
+
+//add gives n points from the bot to the user and returns the new balance.
+func (p *pointsStore) add(user string, n int64, reason string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.balances[user] += n
+	p.dirty = true
+	p.record("", user, n, reason)
+	return p.balances[user]
+}
+
+//take removes n points from the user if the balance is enough.
+func (p *pointsStore) take(user string, n int64, reason string) error {
+	if n <= 0 {
+		return ErrInvalidAmount
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.balances[user] < n {
+		return ErrNotEnoughPoints
+	}
+	p.balances[user] -= n
+	p.dirty = true
+	p.record(user, "", n, reason)
+	return nil
+}
+
+//transfer moves n points between two users if the balance of the sender is enough.
+func (p *pointsStore) transfer(from string, to string, n int64, reason string) error {
+	if n <= 0 {
+		return ErrInvalidAmount
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.balances[from] < n {
+		return ErrNotEnoughPoints
+	}
+	p.balances[from] -= n
+	p.balances[to] += n
+	p.dirty = true
+	p.record(from, to, n, reason)
+	return nil
+}
+
+//set replaces the balance of the user, the difference is recorded in the ledger.
+func (p *pointsStore) set(user string, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	diff := n - p.balances[user]
+	p.balances[user] = n
+	p.dirty = true
+	if diff > 0 {
+		p.record("", user, diff, "admin")
+	} else if diff < 0 {
+		p.record(user, "", -diff, "admin")
+	}
+}
+
+//record appends an entry to the ledger file, it must be called with the lock held.
+func (p *pointsStore) record(from string, to string, n int64, reason string) {
+	f, err := os.OpenFile(p.ledgerFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		p.logTo.Println("Unable to open ledger file: " + err.Error())
+		return
+	}
+	defer f.Close()
+	err = json.NewEncoder(f).Encode(LedgerEntry{Time: time.Now().Unix(), From: from, To: to, Amount: n, Reason: reason})
+	if err != nil {
+		p.logTo.Println("Unable to write ledger entry: " + err.Error())
+	}
+}
+
+//readLedger returns the ledger entries of the bot, if user is not empty only the entries
+//where the user sent or received points are returned.
+func readLedger(botId string, user string) ([]LedgerEntry, error) {
+	f, err := os.Open(ledgerPrefix + botId + suffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []LedgerEntry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	res := []LedgerEntry{}
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var e LedgerEntry
+		err = dec.Decode(&e)
+		if err != nil {
+			return nil, err
+		}
+		if user == "" || e.From == user || e.To == user {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+//award gives n points to the user for chatting, at most once every cooldown seconds.
+func (p *pointsStore) award(user string, n int64, cooldown int64, now int64) {
+	if n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if remainingTimeout(now, cooldown, p.lastAward[user]) > 0 {
+		return
+	}
+	p.lastAward[user] = now
+	p.balances[user] += n
+	p.dirty = true
+}
+
+func (p *pointsStore) all() map[string]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make(map[string]int64, len(p.balances))
+	for k, v := range p.balances {
+		res[k] = v
+	}
+	return res
+}
+
+//replacePoints replaces the {points} and {pointsName} variables of a message.
+func (b *Bot) replacePoints(msg string, n int64) string {
+	msg = strings.ReplaceAll(msg, "{points}", strconv.FormatInt(n, 10))
+	return strings.ReplaceAll(msg, "{pointsName}", b.pointsConfig.Name)
+}
+
+//pointsCommand responds with the balance of the user.
+func (b *Bot) pointsCommand(user string) {
+	if b.pointsConfig.Message == "" {
+		return
+	}
+	b.responseFunction(user, b.replacePoints(b.pointsConfig.Message, b.points.balance(user)))
+}
+
+func (b *Bot) savePoints() {
+	err := b.points.save()
+	if err != nil {
+		b.logTo.Println("Unable to save points: " + err.Error())
+	}
+}
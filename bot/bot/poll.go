@@ -0,0 +1,302 @@
+package bot
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+var ErrPollFormat = errors.New("The poll command is not valid.")
+var ErrPollActive = errors.New("There is alredy an active poll.")
+
+//PollOption is one of the options of a poll and its current number of votes.
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+//PollResults is a snapshot of a poll, it is used for the REST endpoint and the push stream.
+type PollResults struct {
+	Question   string       `json:"question"`
+	Options    []PollOption `json:"options"`
+	Total      int          `json:"total"`
+	Active     bool         `json:"active"`
+	FinishTime int64        `json:"finishTime"`
+}
+
+//poll holds the runtime state of the bot poll.
+//It is shared between the bot loop and the http handlers so every access is guarded by mu.
+type poll struct {
+	mu          sync.Mutex
+	question    string
+	options     []PollOption
+	voters      map[string]int
+	active      bool
+	finishTime  int64
+	subscribers map[chan PollResults]bool
+}
+
+func newPoll() *poll {
+	return &poll{subscribers: make(map[chan PollResults]bool)}
+}
+
+//start resets the poll with a new question and options.
+func (p *poll) start(q string, opts []string, finish int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active {
+		return ErrPollActive
+	}
+	p.question = q
+	p.options = make([]PollOption, len(opts))
+	for i := range opts {
+		p.options[i] = PollOption{Text: opts[i]}
+	}
+	p.voters = make(map[string]int)
+	p.finishTime = finish
+	p.active = true
+	p.broadcast()
+	return nil
+}
+
+//vote registers the vote of a user, the message can be the option number or the option text.
+//Only the first vote of each user is counted.
+//Returns true if the message was a vote for the active poll.
+func (p *poll) vote(user string, msg string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return false
+	}
+	i := p.findOption(msg)
+	if i < 0 {
+		return false
+	}
+	if _, ok := p.voters[user]; ok {
+		return true
+	}
+	p.voters[user] = i
+	p.options[i].Votes++
+	p.broadcast()
+	return true
+}
+
+func (p *poll) findOption(msg string) int {
+	msg = strings.TrimSpace(msg)
+	if n, err := strconv.Atoi(msg); err == nil {
+		if n >= 1 && n <= len(p.options) {
+			return n - 1
+		}
+		return -1
+	}
+	for i := range p.options {
+		if strings.EqualFold(p.options[i].Text, msg) {
+			return i
+		}
+	}
+	return -1
+}
+
+//expired returns true if the poll is active and its time is over.
+func (p *poll) expired(now int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active && now >= p.finishTime
+}
+
+//close finishes the poll and returns the final results.
+func (p *poll) close() PollResults {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active = false
+	p.broadcast()
+	return p.snapshot()
+}
+
+func (p *poll) state() PollState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ps := PollState{Active: p.active, Question: p.question, FinishTime: p.finishTime, Voters: make(map[string]int)}
+	ps.Options = append([]PollOption{}, p.options...)
+	for u, v := range p.voters {
+		ps.Voters[u] = v
+	}
+	return ps
+}
+
+//restore sets the active poll saved by a previous run of the bot, a poll that was finished is ignored.
+func (p *poll) restore(ps PollState) {
+	if !ps.Active || len(ps.Options) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.question = ps.Question
+	p.options = ps.Options
+	p.voters = ps.Voters
+	if p.voters == nil {
+		p.voters = make(map[string]int)
+	}
+	p.finishTime = ps.FinishTime
+	p.active = true
+	p.broadcast()
+}
+
+func (p *poll) results() PollResults {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snapshot()
+}
+
+func (p *poll) snapshot() PollResults {
+	res := PollResults{Question: p.question, Active: p.active, FinishTime: p.finishTime}
+	res.Options = make([]PollOption, len(p.options))
+	copy(res.Options, p.options)
+	for _, o := range p.options {
+		res.Total += o.Votes
+	}
+	return res
+}
+
+//subscribe returns a channel that receives the poll results every time they change.
+//The returned function must be called to stop receiving updates.
+func (p *poll) subscribe() (chan PollResults, func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ch := make(chan PollResults, 1)
+	p.subscribers[ch] = true
+	ch <- p.snapshot()
+	return ch, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.subscribers[ch] {
+			delete(p.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+//closeSubscribers disconnects every subscriber, it is used when the bot stops.
+func (p *poll) closeSubscribers() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ch := range p.subscribers {
+		delete(p.subscribers, ch)
+		close(ch)
+	}
+}
+
+//broadcast sends the current results to every subscriber without blocking.
+//If a subscriber has not read the previous update it is replaced by the newest one.
+func (p *poll) broadcast() {
+	res := p.snapshot()
+	for ch := range p.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- res
+	}
+}
+
+//parsePollCommand parses a message with the format:
+//<command> [seconds] "question" option1 | option2 | ...
+//If the duration is not present d is returned as 0.
+func parsePollCommand(command string, msg string) (string, []string, int64, error) {
+	rest := strings.TrimSpace(strings.TrimPrefix(msg, command))
+	var d int64
+	if !strings.HasPrefix(rest, "\"") {
+		parts := strings.SplitN(rest, " ", 2)
+		if len(parts) < 2 {
+			return "", nil, 0, ErrPollFormat
+		}
+		var err error
+		d, err = strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || d <= 0 {
+			return "", nil, 0, ErrPollFormat
+		}
+		rest = strings.TrimSpace(parts[1])
+	}
+	if !strings.HasPrefix(rest, "\"") {
+		return "", nil, 0, ErrPollFormat
+	}
+	end := strings.Index(rest[1:], "\"")
+	if end < 0 {
+		return "", nil, 0, ErrPollFormat
+	}
+	q := strings.TrimSpace(rest[1 : end+1])
+	var opts []string
+	for _, o := range strings.Split(rest[end+2:], "|") {
+		o = strings.TrimSpace(o)
+		if o != "" {
+			opts = append(opts, o)
+		}
+	}
+	if q == "" || len(opts) < 2 {
+		return "", nil, 0, ErrPollFormat
+	}
+	return q, opts, d, nil
+}
+
+//initPoll starts a new poll from an admin message.
+func (b *Bot) initPoll(mi youtubeapi.MessageItem) {
+	if !utils.ExistsInSlice(mi.Snippet.Author, b.admins) {
+		return
+	}
+	q, opts, d, err := parsePollCommand(b.pollConfig.Command, mi.Snippet.DisplayMessage)
+	if err != nil {
+		b.logTo.Printf("Invalid poll command [%s]", mi.Snippet.DisplayMessage)
+		return
+	}
+	if d == 0 {
+		d = b.pollConfig.DefaultTime
+	}
+	err = b.poll.start(q, opts, time.Now().Unix()+d)
+	if err != nil {
+		b.logTo.Println(err.Error())
+		return
+	}
+	b.logTo.Printf("User %s started the poll [%s]", mi.Snippet.Author, q)
+	if b.pollConfig.StartMessage != "" {
+		var list []string
+		for i, o := range opts {
+			list = append(list, strconv.Itoa(i+1)+") "+o)
+		}
+		stMessage := strings.ReplaceAll(b.pollConfig.StartMessage, "{question}", q)
+		stMessage = strings.ReplaceAll(stMessage, "{options}", strings.Join(list, " "))
+		b.responseFunction(mi.Snippet.Author, stMessage)
+	}
+}
+
+//endPoll closes the poll if its time is over and announces the results.
+func (b *Bot) endPoll() {
+	if !b.poll.expired(time.Now().Unix()) {
+		return
+	}
+	res := b.poll.close()
+	b.logTo.Printf("The poll [%s] finished with %d votes", res.Question, res.Total)
+	if b.pollConfig.FinishMessage == "" {
+		return
+	}
+	var list []string
+	winner := ""
+	max := 0
+	for _, o := range res.Options {
+		list = append(list, o.Text+": "+strconv.Itoa(o.Votes))
+		if o.Votes > max {
+			max = o.Votes
+			winner = o.Text
+		} else if o.Votes == max && max > 0 {
+			winner = winner + ", " + o.Text
+		}
+	}
+	r := strings.ReplaceAll(b.pollConfig.FinishMessage, "{question}", res.Question)
+	r = strings.ReplaceAll(r, "{results}", strings.Join(list, ", "))
+	r = strings.ReplaceAll(r, "{winner}", winner)
+	b.responseFunction("", r)
+}
@@ -0,0 +1,420 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+const (
+	predictionsPrefix = "botpredictions-"
+
+	predictionOpen      = "open"
+	predictionLocked    = "locked"
+	predictionResolved  = "resolved"
+	predictionCancelled = "cancelled"
+	predictionRefunded  = "refunded"
+)
+
+var ErrPredictionActive = errors.New("There is alredy an active prediction.")
+var ErrNoPrediction = errors.New("There is no active prediction.")
+var ErrPredictionLocked = errors.New("The prediction is locked.")
+var ErrInvalidOutcome = errors.New("The outcome is not valid.")
+var ErrOtherOutcome = errors.New("The user alredy bet on another outcome.")
+
+type PredictionOutcome struct {
+	Text    string `json:"text"`
+	Pool    int64  `json:"pool"`
+	Bettors int    `json:"bettors"`
+}
+
+type PredictionBet struct {
+	User    string `json:"user"`
+	Outcome int    `json:"outcome"`
+	Amount  int64  `json:"amount"`
+}
+
+//PredictionRecord contains all the data of a prediction, once the prediction is finished
+//it is appended to the predictions file of the bot.
+type PredictionRecord struct {
+	ChatId   string              `json:"chatId"`
+	Title    string              `json:"title"`
+	Outcomes []PredictionOutcome `json:"outcomes"`
+	Bets     []PredictionBet     `json:"bets"`
+	Status   string              `json:"status"`
+	Result   int                 `json:"result"`
+	Payouts  map[string]int64    `json:"payouts,omitempty"`
+	Opened   int64               `json:"opened"`
+	LockTime int64               `json:"lockTime"`
+	Closed   int64               `json:"closed,omitempty"`
+}
+
+//prediction holds the runtime state of the bot prediction.
+type prediction struct {
+	mu     sync.Mutex
+	active bool
+	record PredictionRecord
+	bets   map[string]int
+}
+
+func newPrediction() *prediction {
+	return &prediction{record: PredictionRecord{Result: -1}}
+}
+
+func (p *prediction) open(chatId string, title string, outcomes []string, lock int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active {
+		return ErrPredictionActive
+	}
+	now := time.Now().Unix()
+	p.record = PredictionRecord{ChatId: chatId, Title: title, Status: predictionOpen, Result: -1, Opened: now, LockTime: lock}
+	for _, o := range outcomes {
+		p.record.Outcomes = append(p.record.Outcomes, PredictionOutcome{Text: o})
+	}
+	p.bets = make(map[string]int)
+	p.active = true
+	return nil
+}
+
+//findOutcome returns the index of the outcome, s can be the outcome number or its text.
+func (p *prediction) findOutcome(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n >= 1 && n <= len(p.record.Outcomes) {
+			return n - 1
+		}
+		return -1
+	}
+	for i := range p.record.Outcomes {
+		if strings.EqualFold(p.record.Outcomes[i].Text, s) {
+			return i
+		}
+	}
+	return -1
+}
+
+//validBet returns the index of the outcome if the user can bet on it.
+func (p *prediction) validBet(user string, outcome string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.checkBet(user, outcome)
+}
+
+//checkBet validates a bet, it must be called with the lock held.
+func (p *prediction) checkBet(user string, outcome string) (int, error) {
+	if !p.active {
+		return -1, ErrNoPrediction
+	}
+	if p.record.Status != predictionOpen {
+		return -1, ErrPredictionLocked
+	}
+	o := p.findOutcome(outcome)
+	if o < 0 {
+		return -1, ErrInvalidOutcome
+	}
+	if i, ok := p.bets[user]; ok && p.record.Bets[i].Outcome != o {
+		return -1, ErrOtherOutcome
+	}
+	return o, nil
+}
+
+//bet registers a bet of the user, the points must be taken from the user before calling it.
+//A user can increase the bet but only for the same outcome.
+func (p *prediction) bet(user string, outcome string, amount int64) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	o, err := p.checkBet(user, outcome)
+	if err != nil {
+		return -1, err
+	}
+	if i, ok := p.bets[user]; ok {
+		p.record.Bets[i].Amount += amount
+	} else {
+		p.bets[user] = len(p.record.Bets)
+		p.record.Bets = append(p.record.Bets, PredictionBet{User: user, Outcome: o, Amount: amount})
+		p.record.Outcomes[o].Bettors++
+	}
+	p.record.Outcomes[o].Pool += amount
+	return o, nil
+}
+
+//lock stops accepting bets, returns true if the prediction was open.
+func (p *prediction) lock() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active || p.record.Status != predictionOpen {
+		return false
+	}
+	p.record.Status = predictionLocked
+	return true
+}
+
+//shouldLock returns true if the prediction is open and its lock time is over.
+func (p *prediction) shouldLock(now int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active && p.record.Status == predictionOpen && p.record.LockTime > 0 && now >= p.record.LockTime
+}
+
+//resolve finishes the prediction and calculates the payouts with splitPool.
+//If nobody bet on the winning outcome every bet is refunded.
+func (p *prediction) resolve(outcome string) (PredictionRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return PredictionRecord{}, ErrNoPrediction
+	}
+	o := p.findOutcome(outcome)
+	if o < 0 {
+		return PredictionRecord{}, ErrInvalidOutcome
+	}
+	var total int64
+	for _, out := range p.record.Outcomes {
+		total += out.Pool
+	}
+	win := p.record.Outcomes[o].Pool
+	if win == 0 {
+		p.record.Payouts = make(map[string]int64)
+		for _, bt := range p.record.Bets {
+			p.record.Payouts[bt.User] = bt.Amount
+		}
+	} else {
+		p.record.Payouts = splitPool(p.record.Bets, o, total, win)
+	}
+	p.record.Result = o
+	p.record.Status = predictionResolved
+	p.record.Closed = time.Now().Unix()
+	p.active = false
+	return p.record, nil
+}
+
+//splitPool shares the total pool between the bets on the winning outcome, win is the pool of that outcome.
+//Each winner receives its bet multiplied by total / win rounded down, the points left by the rounding
+//are given one by one to the winners with the largest fractions, the earliest bets first on a tie.
+//The payouts always add up to the total pool.
+func splitPool(bets []PredictionBet, outcome int, total int64, win int64) map[string]int64 {
+	type share struct {
+		user string
+		frac *big.Int
+	}
+	res := make(map[string]int64)
+	var shares []share
+	left := total
+	bt, bw := big.NewInt(total), big.NewInt(win)
+	for _, b := range bets {
+		if b.Outcome != outcome {
+			continue
+		}
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(big.NewInt(b.Amount), bt), bw, new(big.Int))
+		res[b.User] = q.Int64()
+		left -= q.Int64()
+		shares = append(shares, share{user: b.User, frac: r})
+	}
+	sort.SliceStable(shares, func(i, j int) bool {
+		return shares[i].frac.Cmp(shares[j].frac) > 0
+	})
+	for i := 0; left > 0 && i < len(shares); i++ {
+		res[shares[i].user]++
+		left--
+	}
+	return res
+}
+
+//cancel finishes the prediction and refunds every bet.
+//The status is used to tell apart a cancellation from an admin and a refund because the bot stopped.
+func (p *prediction) cancel(status string) (PredictionRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return PredictionRecord{}, ErrNoPrediction
+	}
+	p.record.Payouts = make(map[string]int64)
+	for _, bt := range p.record.Bets {
+		p.record.Payouts[bt.User] = bt.Amount
+	}
+	p.record.Status = status
+	p.record.Closed = time.Now().Unix()
+	p.active = false
+	return p.record, nil
+}
+
+func (p *prediction) current() PredictionRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := p.record
+	r.Outcomes = append([]PredictionOutcome(nil), p.record.Outcomes...)
+	r.Bets = append([]PredictionBet(nil), p.record.Bets...)
+	return r
+}
+
+//predictionCommand handles the admin prediction commands:
+//<command> [seconds] "title" outcome1 | outcome2 | ...
+//<command> lock
+//<command> resolve <outcome>
+//<command> cancel
+func (b *Bot) predictionCommand(mi youtubeapi.MessageItem) {
+	if !utils.ExistsInSlice(mi.Snippet.Author, b.admins) {
+		return
+	}
+	parts := strings.Fields(strings.TrimPrefix(mi.Snippet.DisplayMessage, b.predictionConfig.Command))
+	if len(parts) == 0 {
+		return
+	}
+	switch parts[0] {
+	case "lock":
+		b.lockPrediction()
+	case "resolve":
+		if len(parts) < 2 {
+			return
+		}
+		rec, err := b.prediction.resolve(strings.Join(parts[1:], " "))
+		if err != nil {
+			b.logTo.Println(err.Error())
+			return
+		}
+		b.logTo.Printf("User %s resolved the prediction [%s]", mi.Snippet.Author, rec.Title)
+		b.finishPrediction(rec)
+	case "cancel":
+		b.refundPrediction(predictionCancelled)
+	default:
+		title, outcomes, d, err := parsePollCommand(b.predictionConfig.Command, mi.Snippet.DisplayMessage)
+		if err != nil {
+			b.logTo.Printf("Invalid prediction command [%s]", mi.Snippet.DisplayMessage)
+			return
+		}
+		if d == 0 {
+			d = b.predictionConfig.DefaultTime
+		}
+		var lock int64
+		if d > 0 {
+			lock = time.Now().Unix() + d
+		}
+		err = b.prediction.open(b.chatId, title, outcomes, lock)
+		if err != nil {
+			b.logTo.Println(err.Error())
+			return
+		}
+		b.logTo.Printf("User %s opened the prediction [%s]", mi.Snippet.Author, title)
+		if b.predictionConfig.StartMessage != "" {
+			var list []string
+			for i, o := range outcomes {
+				list = append(list, strconv.Itoa(i+1)+") "+o)
+			}
+			r := strings.ReplaceAll(b.predictionConfig.StartMessage, "{title}", title)
+			r = strings.ReplaceAll(r, "{outcomes}", strings.Join(list, " "))
+			b.responseFunction(mi.Snippet.Author, r)
+		}
+	}
+}
+
+//betCommand handles a viewer bet with the format <bet> <outcome> <amount>.
+//The points are taken before the bet is registered and returned if the bet is not valid.
+func (b *Bot) betCommand(mi youtubeapi.MessageItem) {
+	parts := strings.Fields(strings.TrimPrefix(mi.Snippet.DisplayMessage, b.predictionConfig.Bet))
+	if len(parts) < 2 {
+		return
+	}
+	user := mi.Snippet.Author
+	amount, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+	if err != nil || amount <= 0 || amount < b.predictionConfig.MinBet {
+		return
+	}
+	outcome := strings.Join(parts[:len(parts)-1], " ")
+	_, err = b.prediction.validBet(user, outcome)
+	if err != nil {
+		b.logTo.Printf("User %s cant bet %d: %s", user, amount, err.Error())
+		return
+	}
+	err = b.points.take(user, amount, "bet")
+	if err != nil {
+		b.logTo.Printf("User %s cant bet %d: %s", user, amount, err.Error())
+		if err == ErrNotEnoughPoints && b.predictionConfig.NoPointsMessage != "" {
+			b.responseFunction(user, b.replacePoints(b.predictionConfig.NoPointsMessage, b.points.balance(user)))
+		}
+		return
+	}
+	//The prediction only changes in the loop so this doesnt fail after validBet, the refund is a safety net
+	_, err = b.prediction.bet(user, outcome, amount)
+	if err != nil {
+		b.points.add(user, amount, "bet refund")
+		b.logTo.Printf("User %s cant bet %d: %s", user, amount, err.Error())
+		return
+	}
+	b.logTo.Printf("User %s bet %d points", user, amount)
+}
+
+//checkPrediction locks the prediction if its time is over.
+func (b *Bot) checkPrediction() {
+	if b.prediction.shouldLock(time.Now().Unix()) {
+		b.lockPrediction()
+	}
+}
+
+func (b *Bot) lockPrediction() {
+	if !b.prediction.lock() {
+		return
+	}
+	rec := b.prediction.current()
+	b.logTo.Printf("The prediction [%s] is locked", rec.Title)
+	if b.predictionConfig.LockMessage != "" {
+		b.responseFunction("", strings.ReplaceAll(b.predictionConfig.LockMessage, "{title}", rec.Title))
+	}
+}
+
+//refundPrediction cancels the active prediction, if there is one, and returns every bet.
+func (b *Bot) refundPrediction(status string) {
+	rec, err := b.prediction.cancel(status)
+	if err != nil {
+		return
+	}
+	b.logTo.Printf("The prediction [%s] was %s", rec.Title, status)
+	b.finishPrediction(rec)
+}
+
+//finishPrediction pays the payouts, saves the record and announces the result.
+func (b *Bot) finishPrediction(rec PredictionRecord) {
+	for u, n := range rec.Payouts {
+		b.points.add(u, n, "prediction "+rec.Status)
+	}
+	b.savePoints()
+	b.savePrediction(rec)
+	var msg string
+	if rec.Status == predictionResolved {
+		var total int64
+		for _, o := range rec.Outcomes {
+			total += o.Pool
+		}
+		msg = strings.ReplaceAll(b.predictionConfig.ResultMessage, "{title}", rec.Title)
+		msg = strings.ReplaceAll(msg, "{outcome}", rec.Outcomes[rec.Result].Text)
+		msg = strings.ReplaceAll(msg, "{winners}", strconv.Itoa(rec.Outcomes[rec.Result].Bettors))
+		msg = strings.ReplaceAll(msg, "{pool}", strconv.FormatInt(total, 10))
+	} else {
+		msg = strings.ReplaceAll(b.predictionConfig.CancelMessage, "{title}", rec.Title)
+	}
+	if msg != "" {
+		b.responseFunction("", msg)
+	}
+}
+
+//savePrediction appends the record to the predictions file of the bot, one record per line.
+func (b *Bot) savePrediction(rec PredictionRecord) {
+	f, err := os.OpenFile(predictionsPrefix+b.BotId+suffix, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		b.logTo.Println("Unable to open predictions file: " + err.Error())
+		return
+	}
+	defer f.Close()
+	err = json.NewEncoder(f).Encode(rec)
+	if err != nil {
+		b.logTo.Println("Unable to save prediction: " + err.Error())
+	}
+}
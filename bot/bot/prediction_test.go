@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPool(t *testing.T) {
+	tests := []struct {
+		name  string
+		bets  []PredictionBet
+		total int64
+		win   int64
+		want  map[string]int64
+	}{
+		{
+			name:  "exact",
+			bets:  []PredictionBet{{User: "a", Outcome: 0, Amount: 100}, {User: "b", Outcome: 0, Amount: 300}, {User: "c", Outcome: 1, Amount: 400}},
+			total: 800, win: 400,
+			want: map[string]int64{"a": 200, "b": 600},
+		},
+		{
+			name:  "remainder to the largest fraction",
+			bets:  []PredictionBet{{User: "a", Outcome: 0, Amount: 1}, {User: "b", Outcome: 0, Amount: 2}, {User: "c", Outcome: 1, Amount: 7}},
+			total: 10, win: 3,
+			want: map[string]int64{"a": 3, "b": 7},
+		},
+		{
+			name:  "remainder tie goes to the earliest bet",
+			bets:  []PredictionBet{{User: "a", Outcome: 0, Amount: 1}, {User: "b", Outcome: 0, Amount: 1}, {User: "c", Outcome: 1, Amount: 1}},
+			total: 3, win: 2,
+			want: map[string]int64{"a": 2, "b": 1},
+		},
+		{
+			name:  "large pools dont overflow",
+			bets:  []PredictionBet{{User: "a", Outcome: 0, Amount: math.MaxInt64 / 4}, {User: "b", Outcome: 1, Amount: math.MaxInt64 / 4}},
+			total: math.MaxInt64 / 4 * 2, win: math.MaxInt64 / 4,
+			want: map[string]int64{"a": math.MaxInt64 / 4 * 2},
+		},
+	}
+	for _, tt := range tests {
+		got := splitPool(tt.bets, 0, tt.total, tt.win)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		var sum int64
+		for _, n := range got {
+			sum += n
+		}
+		if sum != tt.total {
+			t.Errorf("%s: payouts add up to %d, want %d", tt.name, sum, tt.total)
+		}
+	}
+}
+
+func TestResolvePrediction(t *testing.T) {
+	p := newPrediction()
+	if err := p.open("chat", "who wins", []string{"red", "blue"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []struct {
+		user    string
+		outcome string
+		amount  int64
+	}{{"a", "red", 10}, {"b", "2", 5}, {"a", "1", 5}, {"c", "blue", 7}} {
+		if _, err := p.bet(b.user, b.outcome, b.amount); err != nil {
+			t.Fatalf("bet of %s: %v", b.user, err)
+		}
+	}
+	if _, err := p.bet("a", "blue", 1); err != ErrOtherOutcome {
+		t.Errorf("bet on another outcome: got %v, want %v", err, ErrOtherOutcome)
+	}
+	rec, err := p.resolve("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"b": 11, "c": 16}
+	if !reflect.DeepEqual(rec.Payouts, want) {
+		t.Errorf("payouts: got %v, want %v", rec.Payouts, want)
+	}
+	if rec.Status != predictionResolved || rec.Result != 1 {
+		t.Errorf("unexpected record: status %s result %d", rec.Status, rec.Result)
+	}
+}
+
+func TestResolveWithoutWinnersRefunds(t *testing.T) {
+	p := newPrediction()
+	p.open("chat", "who wins", []string{"red", "blue"}, 0)
+	p.bet("a", "red", 10)
+	rec, err := p.resolve("blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{"a": 10}; !reflect.DeepEqual(rec.Payouts, want) {
+		t.Errorf("payouts: got %v, want %v", rec.Payouts, want)
+	}
+}
@@ -0,0 +1,214 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+//QueueEntry is a viewer waiting in the queue.
+type QueueEntry struct {
+	User   string `json:"user"`
+	Name   string `json:"name"`
+	Member bool   `json:"member"`
+	Joined int64  `json:"joined"`
+}
+
+//QueueStatus is a snapshot of the queue used by the REST endpoint.
+type QueueStatus struct {
+	Open    bool         `json:"open"`
+	MaxSize int          `json:"maxSize"`
+	Entries []QueueEntry `json:"entries"`
+}
+
+//viewerQueue holds the ordered list of viewers waiting to play with the streamer.
+//It lives as long as the bot is running.
+type viewerQueue struct {
+	mu      sync.Mutex
+	open    bool
+	entries []QueueEntry
+}
+
+func newViewerQueue() *viewerQueue {
+	return &viewerQueue{}
+}
+
+//join adds the viewer to the queue and returns its position, starting at 1.
+//If memberPriority is true members are placed after the other members but before the rest of the viewers.
+//If the viewer is alredy in the queue its current position is returned.
+//A position of 0 means the queue is closed and -1 that the queue is full.
+func (q *viewerQueue) join(e QueueEntry, maxSize int, memberPriority bool) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.open {
+		return 0
+	}
+	if p := q.find(e.User); p > 0 {
+		return p
+	}
+	if maxSize > 0 && len(q.entries) >= maxSize {
+		return -1
+	}
+	i := len(q.entries)
+	if memberPriority && e.Member {
+		i = 0
+		for i < len(q.entries) && q.entries[i].Member {
+			i++
+		}
+	}
+	q.entries = append(q.entries, QueueEntry{})
+	copy(q.entries[i+1:], q.entries[i:])
+	q.entries[i] = e
+	return i + 1
+}
+
+//leave removes the viewer from the queue, returns false if the viewer was not in it.
+func (q *viewerQueue) leave(user string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p := q.find(user)
+	if p == 0 {
+		return false
+	}
+	q.entries = append(q.entries[:p-1], q.entries[p:]...)
+	return true
+}
+
+//position returns the position of the viewer starting at 1, or 0 if the viewer is not in the queue.
+func (q *viewerQueue) position(user string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.find(user)
+}
+
+func (q *viewerQueue) find(user string) int {
+	for i := range q.entries {
+		if q.entries[i].User == user {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+//next removes and returns the first n viewers of the queue.
+func (q *viewerQueue) next(n int) []QueueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > len(q.entries) {
+		n = len(q.entries)
+	}
+	res := append([]QueueEntry(nil), q.entries[:n]...)
+	q.entries = q.entries[n:]
+	return res
+}
+
+func (q *viewerQueue) setOpen(open bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.open = open
+}
+
+func (q *viewerQueue) clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entries = nil
+}
+
+func (q *viewerQueue) state() QueueState {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueState{Open: q.open, Entries: append([]QueueEntry{}, q.entries...)}
+}
+
+//restore sets the queue saved by a previous run of the bot.
+func (q *viewerQueue) restore(qs QueueState) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.open = qs.Open
+	q.entries = qs.Entries
+}
+
+func (q *viewerQueue) status(maxSize int) QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStatus{Open: q.open, MaxSize: maxSize, Entries: append([]QueueEntry{}, q.entries...)}
+}
+
+//queueCommand handles the viewer and admin queue commands.
+//Returns true if the message was a queue command.
+func (b *Bot) queueCommand(mi youtubeapi.MessageItem) bool {
+	qc := b.queueConfig
+	msg := strings.TrimSpace(mi.Snippet.DisplayMessage)
+	user := mi.Snippet.Author
+	admin := utils.ExistsInSlice(user, b.admins)
+	switch {
+	case qc.Join != "" && msg == qc.Join:
+		e := QueueEntry{User: user, Name: mi.AuthorDetails.DisplayName, Member: mi.AuthorDetails.IsChatSponsor, Joined: time.Now().Unix()}
+		p := b.queue.join(e, qc.MaxSize, qc.MemberPriority)
+		if p == -1 {
+			b.queueResponse(user, qc.FullMessage, p)
+		} else if p > 0 {
+			b.queueResponse(user, qc.JoinMessage, p)
+		}
+	case qc.Leave != "" && msg == qc.Leave:
+		if b.queue.leave(user) {
+			b.queueResponse(user, qc.LeaveMessage, 0)
+		}
+	case qc.Position != "" && msg == qc.Position:
+		if p := b.queue.position(user); p > 0 {
+			b.queueResponse(user, qc.PositionMessage, p)
+		}
+	case qc.Next != "" && (msg == qc.Next || strings.HasPrefix(msg, qc.Next+" ")):
+		if !admin {
+			return true
+		}
+		n := 1
+		parts := strings.Fields(msg)
+		if len(parts) > 1 {
+			var err error
+			n, err = strconv.Atoi(parts[1])
+			if err != nil || n < 1 {
+				return true
+			}
+		}
+		entries := b.queue.next(n)
+		if len(entries) == 0 || qc.NextMessage == "" {
+			return true
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		b.logTo.Printf("User %s called the next %d viewers of the queue", user, len(entries))
+		b.responseFunction(user, strings.ReplaceAll(qc.NextMessage, "{next}", strings.Join(names, ", ")))
+	case qc.Command != "" && strings.HasPrefix(msg, qc.Command+" "):
+		if !admin {
+			return true
+		}
+		switch strings.TrimSpace(strings.TrimPrefix(msg, qc.Command)) {
+		case "open":
+			b.queue.setOpen(true)
+			b.queueResponse(user, qc.OpenMessage, 0)
+		case "close":
+			b.queue.setOpen(false)
+			b.queueResponse(user, qc.CloseMessage, 0)
+		case "clear":
+			b.queue.clear()
+			b.logTo.Printf("User %s cleared the queue", user)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (b *Bot) queueResponse(user string, msg string, position int) {
+	if msg == "" {
+		return
+	}
+	b.responseFunction(user, strings.ReplaceAll(msg, "{position}", strconv.Itoa(position)))
+}
@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+//raidDetector watches the users that write for the first time and the texts repeated by several users.
+//It is only used by the loop so it doesnt need a lock.
+type raidDetector struct {
+	//Time of the first message of every user since the bot started
+	firstSeen map[string]int64
+	//Time of the first message observed, every user is new during the first window so they are not counted
+	started int64
+	//Times of the first messages inside the window
+	newChatters []int64
+	//Users that sent each normalized text inside the window
+	texts map[uint64]map[string]int64
+	//Lockdown state
+	lockdown    bool
+	since       int64
+	lastTrigger int64
+	//Filters replaced by the tightened ones during the lockdown
+	saved Filters
+}
+
+func newRaidDetector() *raidDetector {
+	return &raidDetector{firstSeen: make(map[string]int64), texts: make(map[uint64]map[string]int64)}
+}
+
+//observe records the message and returns the reason of the raid if the thresholds are exceeded.
+func (r *raidDetector) observe(rc RaidDetails, user string, msg string, now int64) string {
+	res := ""
+	if r.started == 0 {
+		r.started = now
+	}
+	if _, ok := r.firstSeen[user]; !ok {
+		r.firstSeen[user] = now
+		if now-r.started >= rc.Window {
+			r.newChatters = append(r.newChatters, now)
+		}
+	}
+	r.newChatters = pruneTimes(r.newChatters, now-rc.Window)
+	if rc.NewChatters > 0 && len(r.newChatters) >= rc.NewChatters {
+		res = "newChatters"
+	}
+	text := normalizeSpam(msg)
+	if len(text) >= rc.MinLength && len(text) > 0 {
+		k := hashText(text)
+		users := r.texts[k]
+		if users == nil {
+			users = make(map[string]int64)
+			r.texts[k] = users
+		}
+		users[user] = now
+		if res == "" && rc.Similar > 0 && len(users) >= rc.Similar {
+			res = "similar"
+		}
+	}
+	return res
+}
+
+//prune removes the texts older than the window.
+func (r *raidDetector) prune(rc RaidDetails, now int64) {
+	r.newChatters = pruneTimes(r.newChatters, now-rc.Window)
+	for k, users := range r.texts {
+		for u, t := range users {
+			if now-t >= rc.Window {
+				delete(users, u)
+			}
+		}
+		if len(users) == 0 {
+			delete(r.texts, k)
+		}
+	}
+}
+
+//regular returns true if the user wrote before the raid started.
+//known is the first message of the user saved in the viewer profiles, 0 if it is unknown,
+//so viewers from previous streams are regulars too.
+func (r *raidDetector) regular(user string, known int64, window int64) bool {
+	t, ok := r.firstSeen[user]
+	if known > 0 && (!ok || known < t) {
+		t, ok = known, true
+	}
+	return ok && t < r.since-window
+}
+
+//tighten returns a stricter copy of the filters used during a lockdown.
+//The filters in shadow mode are enforced and the thresholds of the active filters are halved.
+func tighten(f Filters) Filters {
+	enforce := func(mode string) string {
+		if mode == ModeShadow {
+			return ModeEnforce
+		}
+		return mode
+	}
+	half := func(n int) int {
+		if n > 1 {
+			return n / 2
+		}
+		return n
+	}
+	f.Caps.Mode = enforce(f.Caps.Mode)
+	f.Caps.Percent = f.Caps.Percent / 2
+	f.Caps.Min = half(f.Caps.Min)
+	f.Word.Mode = enforce(f.Word.Mode)
+	f.Links.Mode = enforce(f.Links.Mode)
+	f.Max.Mode = enforce(f.Max.Mode)
+	f.Max.Max = half(f.Max.Max)
+	f.Symbols.Mode = enforce(f.Symbols.Mode)
+	f.Classifier.Mode = enforce(f.Classifier.Mode)
+	f.Symbols.MaxSymbols = f.Symbols.MaxSymbols / 2
+	f.Symbols.MaxRun = half(f.Symbols.MaxRun)
+	f.Symbols.MaxMarks = f.Symbols.MaxMarks / 2
+	f.Spam.Repeat.Mode = enforce(f.Spam.Repeat.Mode)
+	f.Spam.Repeat.Count = half(f.Spam.Repeat.Count)
+	f.Spam.Copypasta.Mode = enforce(f.Spam.Copypasta.Mode)
+	f.Spam.Copypasta.Count = half(f.Spam.Copypasta.Count)
+	f.Spam.Rate.Mode = enforce(f.Spam.Rate.Mode)
+	f.Spam.Rate.Count = half(f.Spam.Rate.Count)
+	return f
+}
+
+//checkRaid records the message and starts the lockdown if a raid is detected.
+//Returns false if the message must be removed because of the lockdown.
+func (b *Bot) checkRaid(mi youtubeapi.MessageItem) bool {
+	rc := b.raidConfig
+	if !rc.Active {
+		return true
+	}
+	now := time.Now().Unix()
+	reason := b.raid.observe(rc, mi.Snippet.Author, mi.Snippet.DisplayMessage, now)
+	if reason != "" {
+		b.raid.lastTrigger = now
+		if !b.raid.lockdown {
+			b.startLockdown(reason, "")
+		}
+	}
+	if !b.raid.lockdown || b.lockdownAllowed(mi) {
+		return true
+	}
+	b.deleteFunction(mi.Id)
+	b.audit.record(AuditEntry{Action: auditModeration, User: mi.Snippet.Author, MessageId: mi.Id, Message: mi.Snippet.DisplayMessage, Rule: "lockdown"})
+	return false
+}
+
+//lockdownAllowed returns true if the author can write during a lockdown.
+func (b *Bot) lockdownAllowed(mi youtubeapi.MessageItem) bool {
+	if b.isModerator(mi) || mi.AuthorDetails.IsChatSponsor || b.raid.regular(mi.Snippet.Author, b.viewers.firstSeen(mi.Snippet.Author), b.raidConfig.Window) {
+		return true
+	}
+	return b.raidConfig.RegularPoints > 0 && b.points.balance(mi.Snippet.Author) >= b.raidConfig.RegularPoints
+}
+
+func (b *Bot) startLockdown(reason string, moderator string) {
+	b.raid.lockdown = true
+	b.raid.since = time.Now().Unix()
+	b.raid.lastTrigger = b.raid.since
+	b.raid.saved = b.filters
+	b.filters = tighten(b.filters)
+	b.pipeline = newPipeline(b.filters)
+	b.logTo.Printf("Lockdown started, reason: %s", reason)
+	b.audit.record(AuditEntry{Action: auditLockdown, Rule: reason, Moderator: moderator})
+	if b.raidConfig.StartMessage != "" {
+		b.responseFunction("", b.raidConfig.StartMessage)
+	}
+}
+
+func (b *Bot) endLockdown(reason string, moderator string) {
+	b.raid.lockdown = false
+	b.filters = b.raid.saved
+	b.pipeline = newPipeline(b.filters)
+	b.logTo.Printf("Lockdown lifted, reason: %s", reason)
+	b.audit.record(AuditEntry{Action: auditLockdownEnd, Rule: reason, Moderator: moderator})
+	if b.raidConfig.EndMessage != "" {
+		b.responseFunction("", b.raidConfig.EndMessage)
+	}
+}
+
+//checkLockdown lifts the lockdown if no raid was detected in the quiet period.
+func (b *Bot) checkLockdown() {
+	if !b.raidConfig.Active {
+		return
+	}
+	now := time.Now().Unix()
+	b.raid.prune(b.raidConfig, now)
+	if b.raid.lockdown && now-b.raid.lastTrigger >= b.raidConfig.Quiet {
+		b.endLockdown("quiet", "")
+	}
+}
+
+//lockdownCommand handles the admin command <command> on|off.
+//Returns true if the message was the lockdown command.
+func (b *Bot) lockdownCommand(mi youtubeapi.MessageItem) bool {
+	rc := b.raidConfig
+	if !rc.Active || rc.Command == "" {
+		return false
+	}
+	parts := strings.Fields(mi.Snippet.DisplayMessage)
+	if len(parts) != 2 || parts[0] != rc.Command {
+		return false
+	}
+	if !utils.ExistsInSlice(mi.Snippet.Author, b.admins) {
+		return true
+	}
+	switch {
+	case parts[1] == "on" && !b.raid.lockdown:
+		b.startLockdown("command", mi.Snippet.Author)
+	case parts[1] == "off" && b.raid.lockdown:
+		b.endLockdown("command", mi.Snippet.Author)
+	}
+	return true
+}
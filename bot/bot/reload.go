@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"time"
+)
+
+const (
+	//Time to wait for a running bot to apply a new configuration
+	reloadTimeout = 30 * time.Second
+	//Seconds between checks of the configuration files
+	configWatchInterval = 5
+)
+
+var ErrReloadTimeout = errors.New("The bot didnt apply the configuration in time.")
+var ErrReloadStopped = errors.New("The bot stopped before applying the configuration.")
+
+//ReloadReport is the result of updating the configuration of a bot.
+//Applied is true if the bot was running and the configuration was applied to it,
+//RestartRequired has the fields that changed but are only used when the bot starts.
+type ReloadReport struct {
+	Applied         bool     `json:"applied"`
+	RestartRequired []string `json:"restartRequired"`
+}
+
+type reloadRequest struct {
+	config LocalConfig
+	result chan []string
+}
+
+//reload sends the configuration to the loop of the bot and waits until it is applied.
+//It gives up if the loop exits or doesnt apply it in reloadTimeout.
+//Returns the fields that need a restart to be applied.
+func (b *Bot) reload(lc LocalConfig) ([]string, error) {
+	req := reloadRequest{config: lc, result: make(chan []string, 1)}
+	timeout := time.After(reloadTimeout)
+	select {
+	case b.reloads <- req:
+	case <-b.done:
+		return nil, ErrReloadStopped
+	case <-timeout:
+		return nil, ErrReloadTimeout
+	}
+	select {
+	case restart := <-req.result:
+		return restart, nil
+	case <-b.done:
+		//The loop may have applied it just before exiting
+		select {
+		case restart := <-req.result:
+			return restart, nil
+		default:
+			return nil, ErrReloadStopped
+		}
+	case <-timeout:
+		return nil, ErrReloadTimeout
+	}
+}
+
+//checkReload applies a pending configuration, it is called by the loop between cycles.
+func (b *Bot) checkReload() {
+	select {
+	case req := <-b.reloads:
+		req.result <- b.applyConfig(req.config)
+	default:
+	}
+}
+
+//applyConfig replaces the configuration of the bot, it must be called from the loop.
+//The cooldowns and remaining uses of the actions, the timed actions schedule, the raffle in progress
+//and the lockdown are kept. Returns the fields that changed but cant be applied without a restart.
+func (b *Bot) applyConfig(lc LocalConfig) []string {
+	old := b.config
+	restart := restartFields(old, lc)
+	b.admins = lc.Configuration.Admins
+	b.excluded = append(append([]string{}, lc.Configuration.Excluded...), b.author)
+	b.quotes = lc.Quotes
+	b.actions = mergeActions(b.actions, old.Actions, lc.Actions)
+	b.timed = mergeTimed(b.timed, lc.Timed, time.Now().Unix())
+
+	raffle := lc.Raffle
+	raffle.Active = b.raffle.Active
+	raffle.Participants = b.raffle.Participants
+	raffle.CustomTime = b.raffle.CustomTime
+	raffle.PrizeAmount = b.raffle.PrizeAmount
+	raffle.FinishTime = b.raffle.FinishTime
+	raffle.Winner = b.raffle.Winner
+	b.raffle = raffle
+
+	if b.raid.lockdown {
+		b.raid.saved = lc.Filter
+		b.filters = tighten(lc.Filter)
+	} else {
+		b.filters = lc.Filter
+	}
+	b.pipeline = newPipeline(b.filters)
+	var classifier Classifier
+	if !reflect.DeepEqual(old.Filter.Classifier, lc.Filter.Classifier) && lc.Filter.Classifier.Active {
+		c, err := newClassifier(lc.BotId, lc.Filter.Classifier)
+		if err != nil {
+			b.logTo.Println("Unable to create classifier: " + err.Error())
+		} else {
+			classifier = c
+		}
+	}
+
+	b.pollConfig = lc.Poll
+	b.pointsConfig = lc.Points
+	b.predictionConfig = lc.Prediction
+	b.minigameConfig = lc.Minigame
+	b.gamblingConfig = lc.Gambling
+	b.gambling.duelAction.UserTimeout = lc.Gambling.DuelCooldown
+	b.gambling.slotsAction.UserTimeout = lc.Gambling.SlotsCooldown
+	b.moderationConfig = lc.Moderation
+	b.raidConfig = lc.Raid
+	b.welcomeConfig = lc.Welcome
+
+	b.mu.Lock()
+	b.queueConfig = lc.Queue
+	b.banLists = lc.Filter.Word.BanList
+	if !reflect.DeepEqual(old.Filter.Classifier, lc.Filter.Classifier) {
+		b.classifier = classifier
+	}
+	b.config = lc
+	b.mu.Unlock()
+	b.rebuildMatcher()
+	b.logTo.Println("Configuration reloaded")
+	return restart
+}
+
+//restartFields returns the fields that changed and are only used when the bot starts.
+func restartFields(old LocalConfig, lc LocalConfig) []string {
+	res := []string{}
+	add := func(field string, changed bool) {
+		if changed {
+			res = append(res, field)
+		}
+	}
+	oc, nc := old.Configuration, lc.Configuration
+	add("type", old.Type != lc.Type)
+	add("configuration.apiKey", oc.ApiKey != nc.ApiKey)
+	add("configuration.refresh", oc.Refresh != nc.Refresh)
+	add("configuration.clientId", oc.ClientId != nc.ClientId)
+	add("configuration.clientS", oc.ClientS != nc.ClientS)
+	add("configuration.liveStreamChannelId", oc.LiveStreamChannelId != nc.LiveStreamChannelId)
+	add("configuration.authorId", oc.AuthorId != nc.AuthorId)
+	add("minigame.triviaPacks", !reflect.DeepEqual(old.Minigame.TriviaPacks, lc.Minigame.TriviaPacks))
+	add("minigame.words", !reflect.DeepEqual(old.Minigame.Words, lc.Minigame.Words))
+	add("minigame.schedule", old.Minigame.Schedule != lc.Minigame.Schedule)
+	add("viewers.expire", old.Viewers.Expire != lc.Viewers.Expire)
+	return res
+}
+
+//newActions creates the actions of the configuration.
+func newActions(config []Action) []Action {
+	var res []Action
+	for _, a := range config {
+		res = append(res,
+			Action{Name: a.Name, Keywords: a.Keywords, Type: a.Type, Message: a.Message, UserTimeout: a.UserTimeout, GlobalTimeout: a.GlobalTimeout, Admin: a.Admin, Uses: a.Uses})
+	}
+	return res
+}
+
+//mergeActions creates the new actions keeping the cooldowns of the current ones with the same name.
+//The remaining uses are kept if the configured uses didnt change.
+func mergeActions(current []Action, oldConfig []Action, config []Action) []Action {
+	res := newActions(config)
+	for i := range res {
+		for _, c := range current {
+			if c.Name != res[i].Name {
+				continue
+			}
+			res[i].LastCalled = c.LastCalled
+			res[i].UserList = c.UserList
+			for _, o := range oldConfig {
+				if o.Name == c.Name && o.Uses == res[i].Uses {
+					res[i].Uses = c.Uses
+				}
+			}
+			break
+		}
+	}
+	return res
+}
+
+//mergeTimed creates the new timed actions keeping the last time the current ones with the same name and type were posted.
+func mergeTimed(current []TimedAction, config []TimedAction, now int64) []TimedAction {
+	var res []TimedAction
+	for _, t := range config {
+		nt := TimedAction{Name: t.Name, Type: t.Type, Cooldown: t.Cooldown, Messages: t.Messages, LastCalled: now}
+		for _, c := range current {
+			if c.Name == t.Name && c.Type == t.Type {
+				nt.LastCalled = c.LastCalled
+				break
+			}
+		}
+		res = append(res, nt)
+	}
+	return res
+}
+
+//watchConfigs checks the configuration files of the bots every few seconds and applies the ones
+//changed on disk to the running bots. It never returns.
+func (bh *BotHandler) watchConfigs() {
+	for {
+		time.Sleep(configWatchInterval * time.Second)
+		for _, id := range bh.botIds() {
+			info, err := os.Stat(prefix + id + suffix)
+			if err != nil {
+				continue
+			}
+			bh.mu.Lock()
+			last, ok := bh.configTimes[id]
+			bh.configTimes[id] = info.ModTime()
+			bh.mu.Unlock()
+			if !ok || !info.ModTime().After(last) {
+				continue
+			}
+			bh.logTo.Printf("Configuration of bot %s changed on disk", id)
+			lc, err := loadLocalConfig(id, bh.logTo)
+			if err != nil {
+				continue
+			}
+			if lc.BotId != id || !lc.validate(bh.logTo) {
+				bh.logTo.Println(ErrorValidating.Error())
+				continue
+			}
+			bh.setBotType(id, lc.Type)
+			bh.applyToRunningBot(lc)
+		}
+	}
+}
+
+//applyToRunningBot applies the configuration to the bot if it is running.
+func (bh *BotHandler) applyToRunningBot(lc LocalConfig) ReloadReport {
+	report := ReloadReport{RestartRequired: []string{}}
+	b, err := bh.getRunningBot(lc.BotId)
+	if err != nil {
+		return report
+	}
+	restart, err := b.reload(lc)
+	if err != nil {
+		bh.logTo.Printf("Unable to apply configuration to bot %s: %s", lc.BotId, err.Error())
+		return report
+	}
+	report.Applied = true
+	report.RestartRequired = restart
+	bh.logTo.Printf("Configuration applied to bot %s, fields that need a restart: %v", lc.BotId, restart)
+	return report
+}
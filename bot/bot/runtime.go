@@ -0,0 +1,210 @@
+package bot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	runtimePrefix = "botruntime-"
+	//List of the bots that were running when the server was stopped
+	resumeFile = "botresume.json"
+)
+
+//ActionState is the runtime state of an action: the uses left and the cooldowns.
+type ActionState struct {
+	Name       string           `json:"name"`
+	Uses       int              `json:"uses"`
+	LastCalled int64            `json:"lastCalled"`
+	UserList   map[string]int64 `json:"userList"`
+}
+
+//TimedState is the last time a timed action was posted.
+type TimedState struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	LastCalled int64  `json:"lastCalled"`
+}
+
+//RaffleState is the raffle in progress of a bot.
+type RaffleState struct {
+	Active       bool     `json:"active"`
+	Participants []string `json:"participants"`
+	CustomTime   int64    `json:"customTime"`
+	PrizeAmount  string   `json:"prizeAmount"`
+	FinishTime   int64    `json:"finishTime"`
+	Winner       string   `json:"winner"`
+}
+
+//QueueState is the viewer queue of a bot.
+type QueueState struct {
+	Open    bool         `json:"open"`
+	Entries []QueueEntry `json:"entries"`
+}
+
+//PollState is the poll of a bot, with the vote of each user.
+type PollState struct {
+	Active     bool           `json:"active"`
+	Question   string         `json:"question"`
+	Options    []PollOption   `json:"options"`
+	Voters     map[string]int `json:"voters"`
+	FinishTime int64          `json:"finishTime"`
+}
+
+//GamblingState is the last time each user played a duel or the slots.
+type GamblingState struct {
+	Duel  map[string]int64 `json:"duel"`
+	Slots map[string]int64 `json:"slots"`
+}
+
+//MinigameState is the active round of the minigames and the time of the next scheduled round.
+type MinigameState struct {
+	Active    string   `json:"active"`
+	Prompt    string   `json:"prompt"`
+	Answers   []string `json:"answers"`
+	EndTime   int64    `json:"endTime"`
+	NextRound int64    `json:"nextRound"`
+}
+
+//RuntimeState is the state of a bot that is only kept in memory while it runs.
+//It is saved when the server shuts down so the bot can resume where it was.
+//Pending duels are not resumed, their points are not taken until the duel is accepted
+//and a challenge lasts less than a restart.
+//Points, predictions, viewers and the shadow report have their own files and are not part of it.
+type RuntimeState struct {
+	Saved    int64         `json:"saved"`
+	Game     string        `json:"game"`
+	Raffle   RaffleState   `json:"raffle"`
+	Actions  []ActionState `json:"actions"`
+	Timed    []TimedState  `json:"timed"`
+	Queue    QueueState    `json:"queue"`
+	Poll     PollState     `json:"poll"`
+	Gambling GamblingState `json:"gambling"`
+	Minigame MinigameState `json:"minigame"`
+}
+
+//ResumeEntry is a bot that was running when the server was stopped.
+type ResumeEntry struct {
+	BotId  string `json:"botId"`
+	LiveId string `json:"liveId"`
+	Game   string `json:"game"`
+}
+
+//runtimeState returns the runtime state of the bot, it must be called when the loop is not running.
+func (b *Bot) runtimeState() RuntimeState {
+	rs := RuntimeState{Saved: time.Now().Unix(), Game: b.currentGame()}
+	rs.Raffle = RaffleState{Active: b.raffle.Active, Participants: b.raffle.Participants, CustomTime: b.raffle.CustomTime,
+		PrizeAmount: b.raffle.PrizeAmount, FinishTime: b.raffle.FinishTime, Winner: b.raffle.Winner}
+	for _, a := range b.actions {
+		rs.Actions = append(rs.Actions, ActionState{Name: a.Name, Uses: a.Uses, LastCalled: a.LastCalled, UserList: a.UserList})
+	}
+	for _, t := range b.timed {
+		rs.Timed = append(rs.Timed, TimedState{Name: t.Name, Type: t.Type, LastCalled: t.LastCalled})
+	}
+	rs.Queue = b.queue.state()
+	rs.Poll = b.poll.state()
+	rs.Gambling = GamblingState{Duel: b.gambling.duelAction.UserList, Slots: b.gambling.slotsAction.UserList}
+	rs.Minigame = MinigameState{Active: b.minigames.active, Prompt: b.minigames.prompt, Answers: b.minigames.answers,
+		EndTime: b.minigames.endTime, NextRound: b.minigames.nextRound}
+	return rs
+}
+
+//restoreRuntime sets the runtime state saved by a previous run of the bot.
+//Actions and timed actions are matched by name, the ones that are no longer configured are ignored.
+func (b *Bot) restoreRuntime(rs RuntimeState) {
+	if rs.Game != "" {
+		b.UpdateGame(rs.Game)
+	}
+	if rs.Raffle.Active {
+		b.raffle.Active = true
+		b.raffle.Participants = rs.Raffle.Participants
+		b.raffle.CustomTime = rs.Raffle.CustomTime
+		b.raffle.PrizeAmount = rs.Raffle.PrizeAmount
+		b.raffle.FinishTime = rs.Raffle.FinishTime
+		b.raffle.Winner = rs.Raffle.Winner
+	}
+	for _, as := range rs.Actions {
+		for i := range b.actions {
+			if b.actions[i].Name == as.Name {
+				b.actions[i].Uses = as.Uses
+				b.actions[i].LastCalled = as.LastCalled
+				b.actions[i].UserList = as.UserList
+				break
+			}
+		}
+	}
+	for _, ts := range rs.Timed {
+		for i := range b.timed {
+			if b.timed[i].Name == ts.Name && b.timed[i].Type == ts.Type {
+				b.timed[i].LastCalled = ts.LastCalled
+				break
+			}
+		}
+	}
+	b.queue.restore(rs.Queue)
+	b.poll.restore(rs.Poll)
+	if rs.Gambling.Duel != nil {
+		b.gambling.duelAction.UserList = rs.Gambling.Duel
+	}
+	if rs.Gambling.Slots != nil {
+		b.gambling.slotsAction.UserList = rs.Gambling.Slots
+	}
+	if rs.Minigame.Active != "" && len(rs.Minigame.Answers) > 0 {
+		b.minigames.active = rs.Minigame.Active
+		b.minigames.prompt = rs.Minigame.Prompt
+		b.minigames.answers = rs.Minigame.Answers
+		b.minigames.endTime = rs.Minigame.EndTime
+	}
+	if rs.Minigame.NextRound > 0 && b.minigames.nextRound > 0 {
+		b.minigames.nextRound = rs.Minigame.NextRound
+	}
+}
+
+//carryRuntime moves the runtime state of a bot whose loop panicked to the bot that replaces it.
+func carryRuntime(old *Bot, b *Bot) {
+	b.restoreRuntime(old.runtimeState())
+	b.restarted = true
+}
+
+func saveRuntimeState(botId string, rs RuntimeState) error {
+	data, err := json.Marshal(rs)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(runtimePrefix+botId+suffix, data, 0666)
+}
+
+//loadRuntimeState reads the saved runtime state of the bot and removes the file, so it is used only once.
+func loadRuntimeState(botId string) (RuntimeState, error) {
+	var rs RuntimeState
+	file := runtimePrefix + botId + suffix
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return rs, err
+	}
+	os.Remove(file)
+	err = json.Unmarshal(data, &rs)
+	return rs, err
+}
+
+func saveResumeList(entries []ResumeEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(resumeFile, data, 0666)
+}
+
+//loadResumeList reads the bots to resume and removes the file.
+func loadResumeList() ([]ResumeEntry, error) {
+	data, err := ioutil.ReadFile(resumeFile)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(resumeFile)
+	var entries []ResumeEntry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+//Modes of a filter.
+const (
+	//The messages caught by the filter are deleted and penalised
+	ModeEnforce = "enforce"
+	//The messages caught by the filter are only recorded in the shadow report
+	ModeShadow = "shadow"
+	//The filter is not used
+	ModeOff = "off"
+)
+
+const (
+	shadowPrefix = "botshadow-"
+	//Maximum number of sample messages kept for each rule
+	shadowSamples = 20
+)
+
+//ShadowHit is a message that would have been removed by a filter in shadow mode.
+type ShadowHit struct {
+	Time    int64   `json:"time"`
+	User    string  `json:"user"`
+	Message string  `json:"message"`
+	Penalty Penalty `json:"penalty"`
+}
+
+//ShadowRule is the report of a single rule, Samples has the most recent hits.
+type ShadowRule struct {
+	Hits    int         `json:"hits"`
+	Samples []ShadowHit `json:"samples"`
+}
+
+//shadowReport keeps what the filters in shadow mode would have done, grouped by rule.
+//It is saved to disk when the bot stops so it can be checked after the stream.
+type shadowReport struct {
+	mu    sync.Mutex
+	file  string
+	rules map[string]ShadowRule
+	logTo *log.Logger
+}
+
+//validMode returns true if the mode is empty or one of the filter modes.
+func validMode(mode string) bool {
+	return mode == "" || mode == ModeEnforce || mode == ModeShadow || mode == ModeOff
+}
+
+//enabled returns true if a filter must be checked, an active filter in mode off is not checked.
+func enabled(active bool, mode string) bool {
+	return active && mode != ModeOff
+}
+
+//loadShadowReport reads the shadow report of the bot, if the file doesnt exists an empty report is returned.
+func loadShadowReport(botId string, l *log.Logger) *shadowReport {
+	s := &shadowReport{file: shadowPrefix + botId + suffix, rules: make(map[string]ShadowRule), logTo: l}
+	data, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.Println("Unable to read shadow report file: " + err.Error())
+		}
+		return s
+	}
+	err = json.Unmarshal(data, &s.rules)
+	if err != nil {
+		l.Println("Unable to decode shadow report file: " + err.Error())
+		s.rules = make(map[string]ShadowRule)
+	}
+	return s
+}
+
+func (s *shadowReport) record(rule string, hit ShadowHit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.rules[rule]
+	r.Hits++
+	r.Samples = append(r.Samples, hit)
+	if len(r.Samples) > shadowSamples {
+		r.Samples = r.Samples[len(r.Samples)-shadowSamples:]
+	}
+	s.rules[rule] = r
+}
+
+func (s *shadowReport) all() map[string]ShadowRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make(map[string]ShadowRule, len(s.rules))
+	for k, v := range s.rules {
+		res[k] = ShadowRule{Hits: v.Hits, Samples: append([]ShadowHit{}, v.Samples...)}
+	}
+	return res
+}
+
+func (s *shadowReport) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = make(map[string]ShadowRule)
+	s.save()
+}
+
+func (s *shadowReport) persist() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.save()
+}
+
+//save must be called with the lock held.
+func (s *shadowReport) save() {
+	data, err := json.Marshal(s.rules)
+	if err != nil {
+		s.logTo.Println("Unable to encode shadow report: " + err.Error())
+		return
+	}
+	err = ioutil.WriteFile(s.file, data, 0666)
+	if err != nil {
+		s.logTo.Println("Unable to save shadow report: " + err.Error())
+	}
+}
+
+//punish applies the verdict of a filter to a message that didnt pass it.
+//In shadow mode the message is only recorded and true is returned, so the message is processed as usual.
+func (b *Bot) punish(msg youtubeapi.MessageItem, v Verdict) bool {
+	if v.Mode == ModeShadow {
+		b.logTo.Printf("Message [%s] would not pass %s validation (shadow mode)", msg.Snippet.DisplayMessage, v.Rule)
+		b.shadow.record(v.Rule, ShadowHit{Time: time.Now().Unix(), User: msg.Snippet.Author, Message: msg.Snippet.DisplayMessage, Penalty: v.Penalty})
+		return true
+	}
+	b.logTo.Printf("Message [%s] didnt pass %s validation %s", msg.Snippet.DisplayMessage, v.Rule, v.Detail)
+	b.deleteFunction(msg.Id)
+	p, r := b.escalate(msg.Snippet.Author, v.Rule, msg.Snippet.DisplayMessage, v.Penalty, v.Message)
+	banId := ""
+	if p.Type != "" {
+		b.logTo.Printf("A %s penalty was applied for message [%s]", v.Rule, msg.Snippet.DisplayMessage)
+		banId, _ = b.penaltyFunction(msg.Snippet.Author, p.Type, p.Duration)
+	}
+	b.audit.record(AuditEntry{Action: auditModeration, User: msg.Snippet.Author, MessageId: msg.Id, Message: msg.Snippet.DisplayMessage, Rule: v.Rule, Penalty: p, BanId: banId})
+	b.logTo.Printf("A response was send for message [%s]", msg.Snippet.DisplayMessage)
+	b.responseFunction(msg.Snippet.Author, r)
+	return false
+}
@@ -0,0 +1,209 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sharedListsDir = "banlists"
+	//Seconds between checks for changes in the shared lists directory
+	sharedListsInterval = 5
+)
+
+var ErrInvalidCategory = errors.New("The category name is not valid.")
+var ErrCategoryNotFound = errors.New("The category doesnt exists.")
+
+var categoryName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+//SharedList is a list of banned words shared by every bot.
+//It is stored in the shared lists directory in a file named after its category.
+type SharedList struct {
+	Category    string   `json:"category"`
+	Description string   `json:"description"`
+	Words       []string `json:"words"`
+}
+
+//sharedLists keeps the shared ban lists loaded from disk and reloads them when the files change.
+//Bots subscribe to be notified when any list changes so they can rebuild their matchers.
+type sharedLists struct {
+	mu          sync.Mutex
+	dir         string
+	lists       map[string]SharedList
+	modified    map[string]time.Time
+	subscribers map[string]func()
+	logTo       *log.Logger
+}
+
+func newSharedLists(dir string, l *log.Logger) *sharedLists {
+	s := &sharedLists{dir: dir, lists: make(map[string]SharedList), modified: make(map[string]time.Time), subscribers: make(map[string]func()), logTo: l}
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		l.Println("Unable to create shared lists directory: " + err.Error())
+	}
+	s.reload()
+	return s
+}
+
+//watch checks the directory periodically and reloads the lists if any file changed.
+//It never returns so it must be run in its own goroutine.
+func (s *sharedLists) watch() {
+	for {
+		time.Sleep(sharedListsInterval * time.Second)
+		if s.reload() {
+			s.notify()
+		}
+	}
+}
+
+//reload reads the files that changed since the last reload, returns true if any list changed.
+func (s *sharedLists) reload() bool {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		s.logTo.Println("Unable to read shared lists directory: " + err.Error())
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	found := make(map[string]bool)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), suffix) {
+			continue
+		}
+		category := strings.TrimSuffix(f.Name(), suffix)
+		if !categoryName.MatchString(category) {
+			continue
+		}
+		found[category] = true
+		if t, ok := s.modified[category]; ok && t.Equal(f.ModTime()) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			s.logTo.Println("Unable to read shared list " + category + ": " + err.Error())
+			continue
+		}
+		var sl SharedList
+		err = json.Unmarshal(data, &sl)
+		if err != nil {
+			s.logTo.Println("Unable to decode shared list " + category + ": " + err.Error())
+			continue
+		}
+		sl.Category = category
+		s.lists[category] = sl
+		s.modified[category] = f.ModTime()
+		s.logTo.Printf("Shared list %s loaded with %d words", category, len(sl.Words))
+		changed = true
+	}
+	for category := range s.lists {
+		if !found[category] {
+			delete(s.lists, category)
+			delete(s.modified, category)
+			s.logTo.Printf("Shared list %s removed", category)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (s *sharedLists) subscribe(botId string, f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[botId] = f
+}
+
+func (s *sharedLists) unsubscribe(botId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, botId)
+}
+
+func (s *sharedLists) notify() {
+	s.mu.Lock()
+	subs := make([]func(), 0, len(s.subscribers))
+	for _, f := range s.subscribers {
+		subs = append(subs, f)
+	}
+	s.mu.Unlock()
+	for _, f := range subs {
+		f()
+	}
+}
+
+//words returns the words of the categories, the categories that dont exist are ignored.
+func (s *sharedLists) words(categories []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []string
+	for _, c := range categories {
+		res = append(res, s.lists[c].Words...)
+	}
+	return res
+}
+
+func (s *sharedLists) categories() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := []string{}
+	for c := range s.lists {
+		res = append(res, c)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (s *sharedLists) get(category string) (SharedList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sl, ok := s.lists[category]
+	if !ok {
+		return SharedList{}, ErrCategoryNotFound
+	}
+	return sl, nil
+}
+
+//save writes the list to disk and notifies the bots.
+func (s *sharedLists) save(sl SharedList) error {
+	if !categoryName.MatchString(sl.Category) {
+		return ErrInvalidCategory
+	}
+	data, err := json.MarshalIndent(sl, "", "    ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(s.dir, sl.Category+suffix), data, 0666)
+	if err != nil {
+		s.logTo.Println("Unable to save shared list " + sl.Category + ": " + err.Error())
+		return ErrorSavingConfig
+	}
+	s.reload()
+	s.notify()
+	return nil
+}
+
+//remove deletes the list from disk and notifies the bots.
+func (s *sharedLists) remove(category string) error {
+	if !categoryName.MatchString(category) {
+		return ErrInvalidCategory
+	}
+	err := os.Remove(filepath.Join(s.dir, category+suffix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrCategoryNotFound
+		}
+		return err
+	}
+	s.reload()
+	s.notify()
+	return nil
+}
@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+const (
+	//Maximum number of messages of a user kept to detect repeated messages
+	repeatHistory = 10
+	//Maximum number of runes compared when looking for near identical messages
+	similarityRunes = 200
+)
+
+type spamMessage struct {
+	time int64
+	text []rune
+}
+
+//spamDetector keeps a sliding window of the recent chat activity to detect floods.
+//Only the data inside the biggest configured window is kept, everything older is pruned.
+type spamDetector struct {
+	//Recent messages of each user, used by the repeat detector
+	history map[string][]spamMessage
+	//Timestamps of the recent messages of each user, used by the rate detector
+	rate map[string][]int64
+	//Users that posted each normalized text recently, used by the copypasta detector
+	pastas map[uint64]map[string]int64
+}
+
+func newSpamDetector() *spamDetector {
+	return &spamDetector{history: make(map[string][]spamMessage), rate: make(map[string][]int64), pastas: make(map[uint64]map[string]int64)}
+}
+
+//check records the message and returns the name and configuration of the first detector triggered by it.
+//Detectors in shadow mode are only returned if no enforced detector was triggered.
+//If no detector is triggered an empty name is returned.
+func (s *spamDetector) check(sf SpamFilter, user string, msg string, now int64) (string, SpamDetector) {
+	text := normalizeSpam(msg)
+	res := ""
+	var det SpamDetector
+	if enabled(sf.Rate.Active, sf.Rate.Mode) {
+		s.rate[user] = append(pruneTimes(s.rate[user], now-sf.Rate.Window), now)
+		if sf.Rate.Count > 0 && len(s.rate[user]) > sf.Rate.Count {
+			res, det = "rate", sf.Rate
+		}
+	}
+	if enabled(sf.Repeat.Active, sf.Repeat.Mode) && len(text) >= sf.Repeat.MinLength {
+		h := s.history[user]
+		c := 1
+		kept := h[:0]
+		for _, m := range h {
+			if now-m.time >= sf.Repeat.Window {
+				continue
+			}
+			kept = append(kept, m)
+			if similar(m.text, text, sf.Repeat.Similarity) {
+				c++
+			}
+		}
+		kept = append(kept, spamMessage{time: now, text: text})
+		if len(kept) > repeatHistory {
+			kept = kept[len(kept)-repeatHistory:]
+		}
+		s.history[user] = kept
+		if (res == "" || det.Mode == ModeShadow) && sf.Repeat.Count > 0 && c >= sf.Repeat.Count {
+			res, det = "repeat", sf.Repeat
+		}
+	}
+	if enabled(sf.Copypasta.Active, sf.Copypasta.Mode) && len(text) >= sf.Copypasta.MinLength {
+		k := hashText(text)
+		users := s.pastas[k]
+		if users == nil {
+			users = make(map[string]int64)
+			s.pastas[k] = users
+		}
+		users[user] = now
+		c := 0
+		for u, t := range users {
+			if now-t >= sf.Copypasta.Window {
+				delete(users, u)
+			} else {
+				c++
+			}
+		}
+		if (res == "" || det.Mode == ModeShadow) && sf.Copypasta.Count > 0 && c >= sf.Copypasta.Count {
+			res, det = "copypasta", sf.Copypasta
+		}
+	}
+	return res, det
+}
+
+//prune removes every entry older than the windows of the detectors.
+//It must be called periodically so inactive users dont stay in memory.
+func (s *spamDetector) prune(sf SpamFilter, now int64) {
+	for u, t := range s.rate {
+		if t = pruneTimes(t, now-sf.Rate.Window); len(t) == 0 {
+			delete(s.rate, u)
+		} else {
+			s.rate[u] = t
+		}
+	}
+	for u, h := range s.history {
+		if len(h) == 0 || now-h[len(h)-1].time >= sf.Repeat.Window {
+			delete(s.history, u)
+		}
+	}
+	for k, users := range s.pastas {
+		for u, t := range users {
+			if now-t >= sf.Copypasta.Window {
+				delete(users, u)
+			}
+		}
+		if len(users) == 0 {
+			delete(s.pastas, k)
+		}
+	}
+}
+
+//pruneTimes removes the timestamps older or equal than limit, the slice must be sorted.
+func pruneTimes(t []int64, limit int64) []int64 {
+	i := 0
+	for i < len(t) && t[i] <= limit {
+		i++
+	}
+	return t[i:]
+}
+
+//normalizeSpam lowers the message and removes everything except letters and digits
+//so small variations like punctuation or spacing are considered the same text.
+func normalizeSpam(msg string) []rune {
+	var res []rune
+	for _, r := range strings.ToLower(msg) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+func hashText(text []rune) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(string(text)))
+	return h.Sum64()
+}
+
+//similar returns true if the similarity of the texts is at least min.
+//The similarity is 1 minus the edit distance divided by the length of the longest text.
+//With a min of 0 or 1 only identical texts are similar.
+func similar(a []rune, b []rune, min float64) bool {
+	if min <= 0 || min >= 1 {
+		return string(a) == string(b)
+	}
+	if len(a) > similarityRunes {
+		a = a[:similarityRunes]
+	}
+	if len(b) > similarityRunes {
+		b = b[:similarityRunes]
+	}
+	max := len(a)
+	if len(b) > max {
+		max = len(b)
+	}
+	if max == 0 {
+		return true
+	}
+	d := len(a) - len(b)
+	if d < 0 {
+		d = -d
+	}
+	if 1-float64(d)/float64(max) < min {
+		return false
+	}
+	return 1-float64(levenshtein(a, b))/float64(max) >= min
+}
+
+//levenshtein calculates the edit distance between two texts using two rows of memory.
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
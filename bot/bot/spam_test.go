@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"hello", "hello", 0},
+		{"hello", "helo", 1},
+		{"ñandú", "nandu", 2},
+	}
+	for _, tt := range tests {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	tests := []struct {
+		a, b string
+		min  float64
+		want bool
+	}{
+		{"helloworld", "helloworld", 0, true},
+		{"helloworld", "helloworle", 0, false},
+		{"helloworld", "helloworle", 1, false},
+		{"helloworld", "helloworle", 0.9, true},
+		{"helloworld", "helloworle", 0.95, false},
+		{"helloworld", "hello", 0.8, false},
+		{"", "", 0.5, true},
+	}
+	for _, tt := range tests {
+		if got := similar([]rune(tt.a), []rune(tt.b), tt.min); got != tt.want {
+			t.Errorf("similar(%q, %q, %v) = %v, want %v", tt.a, tt.b, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSpam(t *testing.T) {
+	if got := string(normalizeSpam("Hello, World!! 2")); got != "helloworld2" {
+		t.Errorf("normalizeSpam = %q, want %q", got, "helloworld2")
+	}
+}
+
+func TestPruneTimes(t *testing.T) {
+	got := pruneTimes([]int64{1, 5, 10, 11, 20}, 10)
+	if len(got) != 2 || got[0] != 11 || got[1] != 20 {
+		t.Errorf("pruneTimes = %v, want [11 20]", got)
+	}
+}
+
+type spamStep struct {
+	user string
+	msg  string
+	time int64
+	want string
+}
+
+func runSpamSteps(t *testing.T, name string, sf SpamFilter, steps []spamStep) {
+	s := newSpamDetector()
+	for i, st := range steps {
+		if got, _ := s.check(sf, st.user, st.msg, st.time); got != st.want {
+			t.Errorf("%s: step %d (%s at %d): got %q, want %q", name, i, st.msg, st.time, got, st.want)
+		}
+	}
+}
+
+func TestSpamDetector(t *testing.T) {
+	tests := []struct {
+		name  string
+		sf    SpamFilter
+		steps []spamStep
+	}{
+		{
+			name: "rate",
+			sf:   SpamFilter{Rate: SpamDetector{Active: true, Window: 10, Count: 3}},
+			steps: []spamStep{
+				{"a", "one", 0, ""},
+				{"a", "two", 1, ""},
+				{"b", "three", 2, ""},
+				{"a", "four", 2, ""},
+				{"a", "five", 3, "rate"},
+				{"a", "six", 20, ""},
+			},
+		},
+		{
+			name: "repeat",
+			sf:   SpamFilter{Repeat: SpamDetector{Active: true, Window: 60, Count: 3, Similarity: 0.8, MinLength: 5}},
+			steps: []spamStep{
+				{"a", "hello world", 0, ""},
+				{"a", "Hello, world!", 10, ""},
+				{"b", "hello world", 15, ""},
+				{"a", "hello worle", 20, "repeat"},
+				{"a", "hi", 21, ""},
+				{"a", "hello world", 100, ""},
+			},
+		},
+		{
+			name: "copypasta",
+			sf:   SpamFilter{Copypasta: SpamDetector{Active: true, Window: 30, Count: 3, MinLength: 10}},
+			steps: []spamStep{
+				{"a", "this is a long copypasta", 0, ""},
+				{"b", "This is a long copypasta!", 5, ""},
+				{"a", "this is a long copypasta", 6, ""},
+				{"c", "this is a long copypasta", 10, "copypasta"},
+				{"d", "this is a long copypasta", 45, ""},
+			},
+		},
+		{
+			name: "enforced detector before shadow",
+			sf: SpamFilter{Rate: SpamDetector{Active: true, Mode: ModeShadow, Window: 10, Count: 1},
+				Repeat: SpamDetector{Active: true, Window: 10, Count: 2}},
+			steps: []spamStep{
+				{"a", "hello", 0, ""},
+				{"a", "hello", 1, "repeat"},
+				{"a", "other", 2, "rate"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		runSpamSteps(t, tt.name, tt.sf, tt.steps)
+	}
+}
+
+func TestSpamPrune(t *testing.T) {
+	sf := SpamFilter{
+		Rate:      SpamDetector{Active: true, Window: 10, Count: 5},
+		Repeat:    SpamDetector{Active: true, Window: 10, Count: 5},
+		Copypasta: SpamDetector{Active: true, Window: 10, Count: 5},
+	}
+	s := newSpamDetector()
+	s.check(sf, "a", "hello there", 0)
+	s.check(sf, "b", "hello again", 8)
+	s.prune(sf, 12)
+	if _, ok := s.rate["a"]; ok {
+		t.Error("rate of a was not pruned")
+	}
+	if _, ok := s.history["a"]; ok {
+		t.Error("history of a was not pruned")
+	}
+	if len(s.rate) != 1 || len(s.history) != 1 || len(s.pastas) != 1 {
+		t.Errorf("unexpected entries after prune: rate %d, history %d, pastas %d", len(s.rate), len(s.history), len(s.pastas))
+	}
+}
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"sync"
+	"time"
+)
+
+//sessionStats counts what a bot did since it was created, they are reset when the bot is started again.
+type sessionStats struct {
+	mu            sync.Mutex
+	started       int64
+	lastPoll      int64
+	lastError     string
+	lastErrorTime int64
+	messages      int
+	actions       int
+	deletions     int
+	bans          int
+	quota         int
+	tokenExpiry   int64
+}
+
+func newSessionStats() *sessionStats {
+	return &sessionStats{}
+}
+
+func (s *sessionStats) start(now int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = now
+}
+
+//polled records a successful read of the chat with n messages.
+func (s *sessionStats) polled(n int, now int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastPoll = now
+	s.messages += n
+}
+
+//call records the quota used by a call to the youtube API and its error, if any.
+func (s *sessionStats) call(units int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quota += units
+	if err != nil {
+		s.lastError = err.Error()
+		s.lastErrorTime = time.Now().Unix()
+	}
+}
+
+func (s *sessionStats) fired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions++
+}
+
+func (s *sessionStats) deleted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletions++
+}
+
+func (s *sessionStats) banned() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bans++
+}
+
+func (s *sessionStats) tokenRefreshed(expiry int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenExpiry = expiry
+}
+
+//BotSummary is the running state of a bot included in the list of bots.
+type BotSummary struct {
+	State    string `json:"state"`
+	Uptime   int64  `json:"uptime"`
+	LastPoll int64  `json:"lastPoll"`
+	Messages int    `json:"messages"`
+}
+
+//BotStatus is the state of a bot and what it did since it was started.
+//Uptime is in seconds, the times are unix timestamps and QuotaUsed is an estimation of the youtube API units used.
+type BotStatus struct {
+	BotId         string `json:"botId"`
+	State         string `json:"state"`
+	StateSince    int64  `json:"stateSince"`
+	StateError    string `json:"stateError,omitempty"`
+	Restarts      int    `json:"restarts"`
+	ChatId        string `json:"chatId,omitempty"`
+	VideoId       string `json:"videoId,omitempty"`
+	Game          string `json:"game,omitempty"`
+	Started       int64  `json:"started,omitempty"`
+	Uptime        int64  `json:"uptime"`
+	LastPoll      int64  `json:"lastPoll,omitempty"`
+	LastError     string `json:"lastError,omitempty"`
+	LastErrorTime int64  `json:"lastErrorTime,omitempty"`
+	Messages      int    `json:"messages"`
+	Actions       int    `json:"actions"`
+	Deletions     int    `json:"deletions"`
+	Bans          int    `json:"bans"`
+	TokenExpiry   int64  `json:"tokenExpiry,omitempty"`
+	QuotaUsed     int    `json:"quotaUsed"`
+}
+
+//status returns the status of the bot, the lifecycle fields are set by the handler.
+func (b *Bot) status(now int64) BotStatus {
+	s := b.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := BotStatus{BotId: b.BotId, ChatId: b.chatId, VideoId: b.videoId, Game: b.currentGame(), Started: s.started,
+		LastPoll: s.lastPoll, LastError: s.lastError, LastErrorTime: s.lastErrorTime, Messages: s.messages, Actions: s.actions,
+		Deletions: s.deletions, Bans: s.bans, TokenExpiry: s.tokenExpiry, QuotaUsed: s.quota}
+	if s.started > 0 {
+		st.Uptime = now - s.started
+	}
+	return st
+}
+
+//getBotStatus returns the status of the bot, if it is not running only its lifecycle state is returned.
+func (bh *BotHandler) getBotStatus(botId string) (BotStatus, error) {
+	rs, err := bh.getBotState(botId)
+	if err != nil {
+		return BotStatus{}, err
+	}
+	st := BotStatus{BotId: botId}
+	if b, errB := bh.getRunningBot(botId); errB == nil {
+		st = b.status(time.Now().Unix())
+	}
+	st.State = rs.State
+	st.StateSince = rs.Since
+	st.StateError = rs.Error
+	st.Restarts = rs.Restarts
+	return st, nil
+}
+
+//summary returns the running state of the bot for the list of bots.
+func (bh *BotHandler) summary(botId string) *BotSummary {
+	st, err := bh.getBotStatus(botId)
+	if err != nil {
+		return nil
+	}
+	return &BotSummary{State: st.State, Uptime: st.Uptime, LastPoll: st.LastPoll, Messages: st.Messages}
+}
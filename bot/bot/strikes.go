@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	strikesPrefix = "botstrikes-"
+)
+
+//Strike is an infraction of a viewer caught by one of the filters.
+type Strike struct {
+	Time    int64  `json:"time"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+//strikeStore keeps the strike history of the viewers of a bot.
+//It is saved to disk every time it changes so repeat offenders keep their record across streams.
+type strikeStore struct {
+	mu      sync.Mutex
+	file    string
+	strikes map[string][]Strike
+	logTo   *log.Logger
+}
+
+//loadStrikeStore reads the strikes file of the bot, if the file doesnt exists an empty store is returned.
+func loadStrikeStore(botId string, l *log.Logger) *strikeStore {
+	s := &strikeStore{file: strikesPrefix + botId + suffix, strikes: make(map[string][]Strike), logTo: l}
+	data, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.Println("Unable to read strikes file: " + err.Error())
+		}
+		return s
+	}
+	err = json.Unmarshal(data, &s.strikes)
+	if err != nil {
+		l.Println("Unable to decode strikes file: " + err.Error())
+		s.strikes = make(map[string][]Strike)
+	}
+	return s
+}
+
+//add records a new strike and returns the number of active strikes of the user, including the new one.
+//Strikes older than decay seconds are not active, a decay of 0 means strikes never expire.
+func (s *strikeStore) add(user string, st Strike, decay int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strikes[user] = append(s.strikes[user], st)
+	s.save()
+	return countActive(s.strikes[user], st.Time, decay)
+}
+
+func (s *strikeStore) get(user string) []Strike {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Strike{}, s.strikes[user]...)
+}
+
+func (s *strikeStore) all() map[string][]Strike {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make(map[string][]Strike, len(s.strikes))
+	for u, st := range s.strikes {
+		res[u] = append([]Strike{}, st...)
+	}
+	return res
+}
+
+//clear removes every strike of the user.
+func (s *strikeStore) clear(user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.strikes, user)
+	s.save()
+}
+
+//save writes the strikes to disk, it must be called with the lock held.
+func (s *strikeStore) save() {
+	data, err := json.Marshal(s.strikes)
+	if err != nil {
+		s.logTo.Println("Unable to encode strikes: " + err.Error())
+		return
+	}
+	err = ioutil.WriteFile(s.file, data, 0666)
+	if err != nil {
+		s.logTo.Println("Unable to save strikes: " + err.Error())
+	}
+}
+
+func countActive(strikes []Strike, now int64, decay int64) int {
+	c := 0
+	for _, st := range strikes {
+		if decay <= 0 || now-st.Time < decay {
+			c++
+		}
+	}
+	return c
+}
+
+//escalate records a strike for the user and returns the penalty and message that must be applied.
+//If strikes are not active the penalty and message of the filter are returned unchanged.
+//The step used is the one matching the number of active strikes, after the last step the last one is repeated.
+//A step without message uses the message of the filter.
+func (b *Bot) escalate(user string, rule string, text string, p Penalty, message string) (Penalty, string) {
+	sc := b.filters.Strikes
+	if !sc.Active || len(sc.Steps) == 0 {
+		return p, message
+	}
+	n := b.strikes.add(user, Strike{Time: time.Now().Unix(), Rule: rule, Message: text}, sc.Decay)
+	if n > len(sc.Steps) {
+		n = len(sc.Steps)
+	}
+	step := sc.Steps[n-1]
+	b.logTo.Printf("User %s has %d active strikes", user, n)
+	if step.Message != "" {
+		message = step.Message
+	}
+	return step.Penalty, message
+}
@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCountActive(t *testing.T) {
+	strikes := []Strike{{Time: 0}, {Time: 50}, {Time: 90}, {Time: 100}}
+	tests := []struct {
+		now   int64
+		decay int64
+		want  int
+	}{
+		{100, 0, 4},
+		{100, 60, 3},
+		{100, 50, 2},
+		{100, 10, 1},
+		{200, 60, 0},
+	}
+	for _, tt := range tests {
+		if got := countActive(strikes, tt.now, tt.decay); got != tt.want {
+			t.Errorf("countActive(now %d, decay %d) = %d, want %d", tt.now, tt.decay, got, tt.want)
+		}
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "strikes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := log.New(ioutil.Discard, "", 0)
+	filterPenalty := Penalty{Type: penaltyTemporary, Duration: 10}
+	steps := []StrikeStep{
+		{Message: "first warning"},
+		{Penalty: Penalty{Type: penaltyTemporary, Duration: 300}},
+		{Penalty: Penalty{Type: penaltyPermanent}, Message: "banned"},
+	}
+	tests := []struct {
+		name    string
+		strikes Strikes
+		want    []Penalty
+		msgs    []string
+	}{
+		{
+			name:    "inactive",
+			strikes: Strikes{Active: false, Steps: steps},
+			want:    []Penalty{filterPenalty, filterPenalty},
+			msgs:    []string{"filter", "filter"},
+		},
+		{
+			name:    "escalates and repeats the last step",
+			strikes: Strikes{Active: true, Steps: steps},
+			want:    []Penalty{{}, {Type: penaltyTemporary, Duration: 300}, {Type: penaltyPermanent}, {Type: penaltyPermanent}},
+			msgs:    []string{"first warning", "filter", "banned", "banned"},
+		},
+	}
+	for _, tt := range tests {
+		b := &Bot{logTo: l, filters: Filters{Strikes: tt.strikes},
+			strikes: &strikeStore{file: filepath.Join(dir, tt.name), strikes: make(map[string][]Strike), logTo: l}}
+		for i := range tt.want {
+			p, m := b.escalate("user", "words", "bad word", filterPenalty, "filter")
+			if p != tt.want[i] || m != tt.msgs[i] {
+				t.Errorf("%s: strike %d: got %+v %q, want %+v %q", tt.name, i+1, p, m, tt.want[i], tt.msgs[i])
+			}
+		}
+		if other, _ := b.escalate("other", "words", "bad word", filterPenalty, "filter"); tt.strikes.Active && other != steps[0].Penalty {
+			t.Errorf("%s: strikes of another user were counted", tt.name)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aiuzu42/aiuzuBot/bot/utils"
+	"github.com/aiuzu42/aiuzuBot/bot/youtubeapi"
+)
+
+const (
+	viewersPrefix = "botviewers-"
+	//Most names kept in the history of a viewer
+	maxViewerNames = 10
+)
+
+var ErrViewerNotFound = errors.New("The viewer is not known by the bot.")
+var ErrEmptyNote = errors.New("The note cant be empty.")
+
+//Note is a free form comment about a viewer left by a moderator.
+type Note struct {
+	Time   int64  `json:"time"`
+	Author string `json:"author"`
+	Text   string `json:"text"`
+}
+
+//Viewer is the profile of a user of the chat.
+//Names has the display names used by the viewer, the current one last.
+//Streams is the number of streams where the viewer wrote, LastStream the chat of the last one.
+//Strikes are kept in the strike store and only set when the profile is returned by the REST api.
+type Viewer struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Names      []string `json:"names"`
+	FirstSeen  int64    `json:"firstSeen"`
+	LastSeen   int64    `json:"lastSeen"`
+	Messages   int      `json:"messages"`
+	Streams    int      `json:"streams"`
+	LastStream string   `json:"lastStream"`
+	Roles      []string `json:"roles"`
+	Notes      []Note   `json:"notes"`
+	Strikes    []Strike `json:"strikes,omitempty"`
+}
+
+//ViewerEdit are the fields of a profile that can be changed through the REST api, nil fields are not changed.
+type ViewerEdit struct {
+	Name  *string `json:"name"`
+	Notes *[]Note `json:"notes"`
+}
+
+//copy returns a copy of the viewer that doesnt share its slices.
+func (vw *Viewer) copy() Viewer {
+	c := *vw
+	c.Names = append([]string{}, vw.Names...)
+	c.Roles = append([]string{}, vw.Roles...)
+	c.Notes = append([]Note{}, vw.Notes...)
+	return c
+}
+
+//addName sets the current name of the viewer and adds it to the history if it is new.
+func (vw *Viewer) addName(name string) {
+	if name == "" {
+		return
+	}
+	vw.Name = name
+	if len(vw.Names) > 0 && vw.Names[len(vw.Names)-1] == name {
+		return
+	}
+	for i, n := range vw.Names {
+		if n == name {
+			vw.Names = append(vw.Names[:i], vw.Names[i+1:]...)
+			break
+		}
+	}
+	vw.Names = append(vw.Names, name)
+	if len(vw.Names) > maxViewerNames {
+		vw.Names = vw.Names[len(vw.Names)-maxViewerNames:]
+	}
+}
+
+//roles returns the roles of the author of a message.
+func roles(a youtubeapi.AuthorDetails) []string {
+	var r []string
+	if a.IsChatOwner {
+		r = append(r, roleOwner)
+	}
+	if a.IsChatModerator {
+		r = append(r, roleModerator)
+	}
+	if a.IsChatSponsor {
+		r = append(r, roleMember)
+	}
+	if a.IsVerified {
+		r = append(r, roleVerified)
+	}
+	return r
+}
+
+//viewerStore keeps the viewer profiles of a bot, it is saved to disk so they are known across streams.
+type viewerStore struct {
+	mu      sync.Mutex
+	file    string
+	viewers map[string]*Viewer
+	dirty   bool
+	//The viewers file did not exist when the bot started, every viewer looks new
+	created bool
+	logTo   *log.Logger
+}
+
+//loadViewerStore reads the viewers file of the bot, if the file doesnt exists an empty store is returned.
+func loadViewerStore(botId string, l *log.Logger) *viewerStore {
+	v := &viewerStore{file: viewersPrefix + botId + suffix, viewers: make(map[string]*Viewer), logTo: l}
+	data, err := ioutil.ReadFile(v.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.Println("Unable to read viewers file: " + err.Error())
+		} else {
+			v.created = true
+		}
+		return v
+	}
+	err = json.Unmarshal(data, &v.viewers)
+	if err != nil {
+		l.Println("Unable to decode viewers file: " + err.Error())
+		v.viewers = make(map[string]*Viewer)
+	}
+	for id, vw := range v.viewers {
+		vw.Id = id
+	}
+	return v
+}
+
+//seen updates the profile of the author of a message written in the stream.
+//Returns true if it is the first message of the viewer and the seconds since its previous message.
+func (v *viewerStore) seen(user string, a youtubeapi.AuthorDetails, stream string, now int64) (bool, int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.dirty = true
+	vw, ok := v.viewers[user]
+	first := !ok
+	if first {
+		vw = &Viewer{Id: user, FirstSeen: now, LastSeen: now}
+		v.viewers[user] = vw
+	}
+	away := now - vw.LastSeen
+	vw.LastSeen = now
+	vw.Messages++
+	vw.addName(a.DisplayName)
+	if vw.LastStream != stream {
+		vw.LastStream = stream
+		vw.Streams++
+	}
+	for _, r := range roles(a) {
+		if !utils.ExistsInSlice(r, vw.Roles) {
+			vw.Roles = append(vw.Roles, r)
+		}
+	}
+	return first, away
+}
+
+//firstSeen returns the time of the first message of the viewer, 0 if it is unknown.
+func (v *viewerStore) firstSeen(user string) int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if vw, ok := v.viewers[user]; ok {
+		return vw.FirstSeen
+	}
+	return 0
+}
+
+//name returns the display name of the viewer, an empty string if it is unknown.
+func (v *viewerStore) name(user string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if vw, ok := v.viewers[user]; ok {
+		return vw.Name
+	}
+	return ""
+}
+
+//setName sets the name of a viewer obtained from the youtube API, creating the profile if needed.
+func (v *viewerStore) setName(user string, name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	vw, ok := v.viewers[user]
+	if !ok {
+		vw = &Viewer{Id: user}
+		v.viewers[user] = vw
+	}
+	vw.addName(name)
+	v.dirty = true
+}
+
+func (v *viewerStore) get(user string) (Viewer, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	vw, ok := v.viewers[user]
+	if !ok {
+		return Viewer{}, ErrViewerNotFound
+	}
+	return vw.copy(), nil
+}
+
+//search returns the viewers that used a name containing the text and have the role, sorted by last seen.
+//An empty text or role matches every viewer.
+func (v *viewerStore) search(text string, role string) []Viewer {
+	text = strings.ToLower(text)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	res := []Viewer{}
+	for _, vw := range v.viewers {
+		if role != "" && !utils.ExistsInSlice(role, vw.Roles) {
+			continue
+		}
+		if text != "" && !matchesName(vw, text) {
+			continue
+		}
+		res = append(res, vw.copy())
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastSeen > res[j].LastSeen
+	})
+	return res
+}
+
+func matchesName(vw *Viewer, text string) bool {
+	if strings.Contains(strings.ToLower(vw.Id), text) {
+		return true
+	}
+	for _, n := range vw.Names {
+		if strings.Contains(strings.ToLower(n), text) {
+			return true
+		}
+	}
+	return false
+}
+
+//edit changes the profile of a viewer and saves the store.
+func (v *viewerStore) edit(user string, e ViewerEdit) (Viewer, error) {
+	v.mu.Lock()
+	vw, ok := v.viewers[user]
+	if !ok {
+		v.mu.Unlock()
+		return Viewer{}, ErrViewerNotFound
+	}
+	if e.Name != nil {
+		vw.addName(*e.Name)
+	}
+	if e.Notes != nil {
+		vw.Notes = append([]Note{}, (*e.Notes)...)
+	}
+	v.dirty = true
+	res := vw.copy()
+	v.mu.Unlock()
+	return res, v.save()
+}
+
+//addNote adds a note to the profile of a viewer and saves the store.
+func (v *viewerStore) addNote(user string, n Note) (Viewer, error) {
+	if strings.TrimSpace(n.Text) == "" {
+		return Viewer{}, ErrEmptyNote
+	}
+	v.mu.Lock()
+	vw, ok := v.viewers[user]
+	if !ok {
+		v.mu.Unlock()
+		return Viewer{}, ErrViewerNotFound
+	}
+	if n.Time == 0 {
+		n.Time = time.Now().Unix()
+	}
+	vw.Notes = append(vw.Notes, n)
+	v.dirty = true
+	res := vw.copy()
+	v.mu.Unlock()
+	return res, v.save()
+}
+
+//remove forgets a viewer and saves the store.
+func (v *viewerStore) remove(user string) error {
+	v.mu.Lock()
+	if _, ok := v.viewers[user]; !ok {
+		v.mu.Unlock()
+		return ErrViewerNotFound
+	}
+	delete(v.viewers, user)
+	v.dirty = true
+	v.mu.Unlock()
+	return v.save()
+}
+
+//expire forgets the viewers without notes that have not written in the last seconds.
+//Seconds of 0 or less keeps every viewer.
+func (v *viewerStore) expire(now int64, seconds int64) int {
+	if seconds <= 0 {
+		return 0
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c := 0
+	for id, vw := range v.viewers {
+		if len(vw.Notes) == 0 && now-vw.LastSeen > seconds {
+			delete(v.viewers, id)
+			c++
+		}
+	}
+	if c > 0 {
+		v.dirty = true
+	}
+	return c
+}
+
+//save writes the viewers to disk if they changed since the last save.
+func (v *viewerStore) save() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.dirty {
+		return nil
+	}
+	data, err := json.Marshal(v.viewers)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(v.file, data, 0666)
+	if err != nil {
+		return err
+	}
+	v.dirty = false
+	return nil
+}
+
+func (b *Bot) saveViewers() {
+	err := b.viewers.save()
+	if err != nil {
+		b.logTo.Println("Unable to save viewers: " + err.Error())
+	}
+}
+
+//welcome greets the new viewers and the ones that return after being away, first and away are the
+//values returned by viewerStore.seen for the message.
+//Nobody is welcomed during a lockdown or when the viewers file was just created, because every chatter would be new.
+func (b *Bot) welcome(mi youtubeapi.MessageItem, first bool, away int64) {
+	wc := b.welcomeConfig
+	user := mi.Snippet.Author
+	if !wc.Active || b.raid.lockdown || b.viewers.created || utils.ExistsInSlice(user, b.admins) {
+		return
+	}
+	if first {
+		b.logTo.Printf("First message of user %s", user)
+		if wc.Message != "" {
+			b.responseFunction(user, wc.Message)
+		}
+		if wc.AlertMessage != "" {
+			b.logTo.Printf("New viewer alert for user %s: %s", user, wc.AlertMessage)
+			b.audit.record(AuditEntry{Action: auditNewViewer, User: user, MessageId: mi.Id, Message: mi.Snippet.DisplayMessage, Reason: wc.AlertMessage})
+		}
+	} else if wc.BackAfter > 0 && away >= wc.BackAfter && wc.BackMessage != "" {
+		b.logTo.Printf("User %s is back after %d seconds", user, away)
+		b.responseFunction(user, wc.BackMessage)
+	}
+}
+
+//restricted returns true if the author is a new viewer that cant use links or commands yet.
+//The moderators and members are never restricted, and nobody is when the viewers file was just created.
+func (b *Bot) restricted(mi youtubeapi.MessageItem) bool {
+	wc := b.welcomeConfig
+	if !wc.Active || wc.Restrict <= 0 || b.viewers.created || b.isModerator(mi) || mi.AuthorDetails.IsChatSponsor {
+		return false
+	}
+	return time.Now().Unix()-b.viewers.firstSeen(mi.Snippet.Author) < wc.Restrict
+}
+
+//holdNewViewer removes the message of a restricted viewer if it has links.
+func (b *Bot) holdNewViewer(mi youtubeapi.MessageItem) {
+	if len(utils.FindDomains(mi.Snippet.DisplayMessage)) == 0 {
+		return
+	}
+	b.logTo.Printf("Message [%s] of new user %s has links", mi.Snippet.DisplayMessage, mi.Snippet.Author)
+	b.deleteFunction(mi.Id)
+	b.audit.record(AuditEntry{Action: auditModeration, User: mi.Snippet.Author, MessageId: mi.Id, Message: mi.Snippet.DisplayMessage, Rule: "newViewer"})
+	if b.welcomeConfig.RestrictMessage != "" {
+		b.responseFunction(mi.Snippet.Author, b.welcomeConfig.RestrictMessage)
+	}
+}
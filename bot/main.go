@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/aiuzu42/aiuzuBot/bot/bot"
@@ -11,6 +15,9 @@ import (
 )
 
 func main() {
+	resume := flag.Bool("resume", false, "Start the bots that were running when the server was stopped")
+	flag.Parse()
+
 	//Prepare log
 	now := time.Now()
 	fileName := "mainLog" + now.Format("020120061504") + ".txt"
@@ -34,10 +41,63 @@ func main() {
 	router.HandleFunc("/aiuzubot/v3/bot/{botid}/config", bh.UpdateBotConfigEndpoint).Methods("PUT")
 	router.HandleFunc("/aiuzubot/v3/bot/{botid}/info", bh.UpdateBotInfoEndpoint).Methods("PUT")
 	router.HandleFunc("/aiuzubot/v3/bot/{botid}/info", bh.GetBotInfoEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/poll", bh.GetPollEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/poll/stream", bh.PollStreamEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/prediction", bh.GetPredictionEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/points", bh.GetPointsEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/points/{userid}", bh.UpdatePointsEndpoint).Methods("PUT")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/queue", bh.GetQueueEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/ledger", bh.GetLedgerEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/state", bh.GetBotStateEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/status", bh.GetBotStatusEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/strikes", bh.GetStrikesEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/strikes/{userid}", bh.GetStrikesEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/strikes/{userid}", bh.ClearStrikesEndpoint).Methods("DELETE")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/shadow", bh.GetShadowReportEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/shadow", bh.ClearShadowReportEndpoint).Methods("DELETE")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/audit", bh.GetAuditEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/audit/{entryid}/undo", bh.UndoAuditEndpoint).Methods("POST")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/bans/{userid}", bh.UnbanEndpoint).Methods("DELETE")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/decisions", bh.GetDecisionsEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/classifier/train", bh.TrainClassifierEndpoint).Methods("POST")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/viewers", bh.SearchViewersEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/viewers/{userid}", bh.GetViewerEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/viewers/{userid}", bh.UpdateViewerEndpoint).Methods("PUT")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/viewers/{userid}", bh.DeleteViewerEndpoint).Methods("DELETE")
+	router.HandleFunc("/aiuzubot/v3/bot/{botid}/viewers/{userid}/notes", bh.AddViewerNoteEndpoint).Methods("POST")
+	router.HandleFunc("/aiuzubot/v3/banlists", bh.GetBanListsEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/banlists/{category}", bh.GetBanListEndpoint).Methods("GET")
+	router.HandleFunc("/aiuzubot/v3/banlists/{category}", bh.UpdateBanListEndpoint).Methods("PUT")
+	router.HandleFunc("/aiuzubot/v3/banlists/{category}", bh.DeleteBanListEndpoint).Methods("DELETE")
 	router.HandleFunc("/aiuzubit/v3/bot", bh.AddNewBotEndpoint).Methods("POST")
 
-	http.ListenAndServe(":3000", router)
+	srv := &http.Server{Addr: ":3000", Handler: router}
+	errS := make(chan error, 1)
+	go func() {
+		errS <- srv.ListenAndServe()
+	}()
+	if *resume {
+		go bh.Resume()
+	}
 
+	//Wait for a signal to stop the server and the bots
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case s := <-stop:
+		l.Println("Shutting down, received signal: " + s.String())
+	case err := <-errS:
+		l.Println("Server error: " + err.Error())
+	}
+	//The bots are stopped first, the poll streams only end when the bot closes its subscribers
+	bh.Shutdown()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		l.Println("Unable to drain the server: " + err.Error())
+	}
+	l.Println("Shutdown complete")
 }
 
 func routerMiddleware(next http.Handler) http.Handler {
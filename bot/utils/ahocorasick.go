@@ -0,0 +1,86 @@
+package utils
+
+//acNode is a state of the Aho-Corasick automaton.
+type acNode struct {
+	next map[byte]int32
+	fail int32
+	//Patterns that end in this state, including the ones of its fail states
+	out []int32
+}
+
+//ahoCorasick finds every occurrence of a set of patterns in a single pass over the text.
+type ahoCorasick struct {
+	nodes    []acNode
+	patterns []string
+}
+
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{patterns: patterns}
+	ac.nodes = append(ac.nodes, acNode{next: make(map[byte]int32)})
+	for i, p := range patterns {
+		if p == "" {
+			continue
+		}
+		cur := int32(0)
+		for j := 0; j < len(p); j++ {
+			n, ok := ac.nodes[cur].next[p[j]]
+			if !ok {
+				n = int32(len(ac.nodes))
+				ac.nodes = append(ac.nodes, acNode{next: make(map[byte]int32)})
+				ac.nodes[cur].next[p[j]] = n
+			}
+			cur = n
+		}
+		ac.nodes[cur].out = append(ac.nodes[cur].out, int32(i))
+	}
+	//Breadth first search to calculate the fail links
+	queue := make([]int32, 0, len(ac.nodes))
+	for _, n := range ac.nodes[0].next {
+		queue = append(queue, n)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for c, n := range ac.nodes[cur].next {
+			f := ac.nodes[cur].fail
+			for {
+				if t, ok := ac.nodes[f].next[c]; ok {
+					ac.nodes[n].fail = t
+					break
+				}
+				if f == 0 {
+					ac.nodes[n].fail = 0
+					break
+				}
+				f = ac.nodes[f].fail
+			}
+			ac.nodes[n].out = append(ac.nodes[n].out, ac.nodes[ac.nodes[n].fail].out...)
+			queue = append(queue, n)
+		}
+	}
+	return ac
+}
+
+//find calls found with the pattern index and the position where it ends for every occurrence in s.
+//The search stops when found returns false.
+func (ac *ahoCorasick) find(s string, found func(pattern int, end int) bool) {
+	cur := int32(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		for {
+			if n, ok := ac.nodes[cur].next[c]; ok {
+				cur = n
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = ac.nodes[cur].fail
+		}
+		for _, p := range ac.nodes[cur].out {
+			if !found(int(p), i+1) {
+				return
+			}
+		}
+	}
+}
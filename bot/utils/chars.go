@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"unicode"
+)
+
+//CharStats counts the classes of the characters of a message, spaces are not counted.
+type CharStats struct {
+	//Characters that are not combining marks
+	Bases int
+	//Symbols and emoji
+	Symbols int
+	//Nonspacing combining marks, like the ones used to write zalgo text
+	Marks int
+	//Length of the longest run of the same character
+	LongestRun int
+}
+
+//Characters that are part of emoji sequences and are not counted as marks.
+func emojiJoiner(r rune) bool {
+	return r == 0x200D || (r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0020 && r <= 0xE007F)
+}
+
+//Chars returns the character statistics of the message.
+func Chars(s string) CharStats {
+	var st CharStats
+	var last rune = -1
+	run := 0
+	for _, r := range s {
+		if r == last {
+			run++
+		} else {
+			last = r
+			run = 1
+		}
+		if run > st.LongestRun && !unicode.IsSpace(r) {
+			st.LongestRun = run
+		}
+		switch {
+		case unicode.IsSpace(r) || emojiJoiner(r):
+		case unicode.Is(unicode.Me, r):
+			//Enclosing marks, like the keycap of the emoji 1️⃣, are part of the symbol before them
+		case unicode.Is(unicode.Mn, r):
+			st.Marks++
+		case unicode.IsSymbol(r):
+			st.Symbols++
+			st.Bases++
+		default:
+			st.Bases++
+		}
+	}
+	return st
+}
+
+//ValidScript returns true if the name is one of the unicode scripts, like Latin or Cyrillic.
+func ValidScript(name string) bool {
+	_, ok := unicode.Scripts[name]
+	return ok
+}
+
+//ScriptsAllowed returns true if every letter of the message belongs to one of the scripts.
+//Digits, symbols and punctuation are always allowed, an empty list allows every script.
+func ScriptsAllowed(s string, scripts []string) bool {
+	if len(scripts) == 0 {
+		return true
+	}
+	var tables []*unicode.RangeTable
+	for _, name := range scripts {
+		if t, ok := unicode.Scripts[name]; ok {
+			tables = append(tables, t)
+		}
+	}
+	for _, r := range s {
+		if unicode.IsLetter(r) && !unicode.IsOneOf(tables, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestChars(t *testing.T) {
+	tests := []struct {
+		in   string
+		want CharStats
+	}{
+		{"hello", CharStats{Bases: 5, LongestRun: 2}},
+		{"a  b", CharStats{Bases: 2, LongestRun: 1}},
+		{"nooooo", CharStats{Bases: 6, LongestRun: 5}},
+		{"h̵̡e̶", CharStats{Bases: 2, Marks: 3, LongestRun: 1}},
+		{"1️⃣ #️⃣", CharStats{Bases: 2, LongestRun: 1}},
+		{"a⃝", CharStats{Bases: 1, LongestRun: 1}},
+		{"👍👍👍", CharStats{Bases: 3, Symbols: 3, LongestRun: 3}},
+		{"👨‍👩", CharStats{Bases: 2, Symbols: 2, LongestRun: 1}},
+	}
+	for _, tt := range tests {
+		if got := Chars(tt.in); got != tt.want {
+			t.Errorf("Chars(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestScriptsAllowed(t *testing.T) {
+	tests := []struct {
+		in      string
+		scripts []string
+		want    bool
+	}{
+		{"hello 123 !!", []string{"Latin"}, true},
+		{"привет", []string{"Latin"}, false},
+		{"hello привет", []string{"Latin", "Cyrillic"}, true},
+		{"привет", nil, true},
+		{"привет", []string{"Unknown"}, false},
+	}
+	for _, tt := range tests {
+		if got := ScriptsAllowed(tt.in, tt.scripts); got != tt.want {
+			t.Errorf("ScriptsAllowed(%q, %v) = %v, want %v", tt.in, tt.scripts, got, tt.want)
+		}
+	}
+}
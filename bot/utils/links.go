@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+//Top level domains accepted when a link is written without scheme.
+//Without this list any two words joined by a dot would be considered a link.
+var tlds = []string{"com", "net", "org", "info", "biz", "io", "gg", "tv", "co", "me", "ly", "be", "xyz",
+	"app", "dev", "live", "link", "site", "online", "shop", "store", "club", "top", "vip", "fun", "win",
+	"click", "stream", "gift", "cc", "ws", "to", "fm", "sh", "tk", "ml", "ga", "cf", "gq", "ru", "de",
+	"uk", "us", "ca", "fr", "es", "it", "nl", "jp", "br", "mx", "ar", "cl", "pe", "ve", "ai", "su", "cn"}
+
+//Top level domains accepted for links obfuscated with "dot", "(.)" or "[.]", they dont include domains
+//that are also common words so normal sentences like "I went home. To be honest" are not detected as links.
+var obfuscatedTlds = []string{"com", "net", "org", "info", "biz", "io", "xyz", "ru", "site", "online",
+	"shop", "store", "club", "top", "click", "gift", "ly"}
+
+//Top level domains accepted for links written with spaces around the dots and no other obfuscation.
+//Any sentence can have a dot followed by a word, so only domains that are not words are used.
+var spacedTlds = []string{"com", "org", "biz", "io", "xyz", "ru"}
+
+var (
+	obfuscatedDot = regexp.MustCompile(`(?i)\s*(?:[\(\[\{<]\s*(?:dot|punto|\.)\s*[\)\]\}>]|\s+(?:dot|punto)\s+)\s*`)
+	spacedDot     = regexp.MustCompile(`\s*\.\s*`)
+	schemeLink    = regexp.MustCompile(`(?i)(?:https?|ftp)\s*:\s*/\s*/\s*([a-z0-9.-]+)`)
+	domainLink    = regexp.MustCompile(`(?i)[a-z0-9](?:[a-z0-9-]*[a-z0-9])?(?:\.[a-z0-9](?:[a-z0-9-]*[a-z0-9])?)+`)
+)
+
+//FindDomains returns the domains of the links found in the message, in lower case.
+//It detects links with and without scheme and common obfuscations like "example dot com",
+//"example(dot)com" or spaces around the dots.
+func FindDomains(msg string) []string {
+	var res []string
+	add := func(d string) {
+		d = strings.Trim(strings.ToLower(d), ".-")
+		if d != "" && !ExistsInSlice(d, res) {
+			res = append(res, d)
+		}
+	}
+	for _, m := range schemeLink.FindAllStringSubmatch(msg, -1) {
+		add(m[1])
+	}
+	for _, d := range domainLink.FindAllString(msg, -1) {
+		if ExistsInSlice(topLevelDomain(d), tlds) {
+			add(d)
+		}
+	}
+	if obfuscatedDot.MatchString(msg) {
+		s := obfuscatedDot.ReplaceAllString(msg, ".")
+		s = spacedDot.ReplaceAllString(s, ".")
+		for _, d := range domainLink.FindAllString(s, -1) {
+			if ExistsInSlice(topLevelDomain(d), obfuscatedTlds) {
+				add(d)
+			}
+		}
+	}
+	for _, d := range domainLink.FindAllString(spacedDot.ReplaceAllString(msg, "."), -1) {
+		if ExistsInSlice(topLevelDomain(d), spacedTlds) {
+			add(d)
+		}
+	}
+	return res
+}
+
+func topLevelDomain(d string) string {
+	return strings.ToLower(d[strings.LastIndex(d, ".")+1:])
+}
+
+//DomainAllowed returns true if the domain is one of the allowed domains or a subdomain of one of them.
+func DomainAllowed(domain string, allowed []string) bool {
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if domain == a || strings.HasSuffix(domain, "."+a) {
+			return true
+		}
+	}
+	return false
+}
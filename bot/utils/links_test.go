@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindDomains(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want []string
+	}{
+		{"check https://Example.com/video", []string{"example.com"}},
+		{"go to www.example.tv now", []string{"www.example.tv"}},
+		{"example dot com", []string{"example.com"}},
+		{"example(dot)net", []string{"example.net"}},
+		{"example [.] club", []string{"example.club"}},
+		{"example . com", []string{"example.com"}},
+		{"free stuff . ru", []string{"stuff.ru"}},
+		{"nice play. Top notch", nil},
+		{"I went home. Online again tomorrow", nil},
+		{"what a game. Info in the description", nil},
+		{"go to the shop. Store it later", nil},
+		{"that was fun. Click the like button", nil},
+		{"I went home. To be honest it was late", nil},
+		{"3.5 stars", nil},
+		{"hello everyone", nil},
+	}
+	for _, tt := range tests {
+		if got := FindDomains(tt.msg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FindDomains(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestDomainAllowed(t *testing.T) {
+	allowed := []string{"youtube.com", "Twitter.com"}
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"youtube.com", true},
+		{"www.youtube.com", true},
+		{"twitter.com", true},
+		{"notyoutube.com", false},
+		{"youtube.com.evil.ru", false},
+	}
+	for _, tt := range tests {
+		if got := DomainAllowed(tt.domain, allowed); got != tt.want {
+			t.Errorf("DomainAllowed(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
@@ -3,30 +3,184 @@ package utils
 import (
 	"log"
 	"regexp"
+	"strings"
+	"sync/atomic"
 )
 
+//Types of entries of a ban list.
+const (
+	//The entry is matched as it is written
+	EntryLiteral = "literal"
+	//The entry can contain * to match any number of letters and ? to match a single letter
+	EntryWildcard = "wildcard"
+	//The entry is a regular expression
+	EntryRegex = "regex"
+)
+
+//MatchList is a ban list used to build a Matcher.
+type MatchList struct {
+	Words         []string
+	Normalization string
+	Entries       string
+}
+
+//MatchResult reports the list and the term that matched a message.
+type MatchResult struct {
+	List int
+	Term string
+}
+
+//Matcher finds banned words of several lists in a message.
+//Literal entries of all the lists that share a normalization level are searched in a single pass
+//with an Aho-Corasick automaton, wildcard and regex entries are compiled to regular expressions.
+//The lists can be replaced while the matcher is in use, the change is atomic.
 type Matcher struct {
-	rgxp []*regexp.Regexp
+	current atomic.Value
+}
+
+type matcherPattern struct {
+	list int
+	term string
+}
+
+type matcherRegexp struct {
+	list  int
+	term  string
+	level string
+	rgxp  *regexp.Regexp
+}
+
+//matcherData is an immutable snapshot of the compiled lists.
+type matcherData struct {
+	levels   []string
+	automata map[string]*ahoCorasick
+	patterns map[string][]matcherPattern
+	rgxps    []matcherRegexp
+}
+
+//ValidEntryType returns true if the type is empty or one of the entry types.
+func ValidEntryType(t string) bool {
+	return t == "" || ExistsInSlice(t, []string{EntryLiteral, EntryWildcard, EntryRegex})
+}
+
+//NewMatcher compiles the ban lists.
+//Literal and wildcard entries are normalized with the same level used for the messages,
+//regex entries are used as they are. An empty entry type is the same as EntryLiteral.
+func NewMatcher(lists []MatchList, log *log.Logger) *Matcher {
+	m := &Matcher{}
+	m.Rebuild(lists, log)
+	return m
 }
 
-func NewMatcher(words []string, log *log.Logger) Matcher {
-	m := Matcher{}
-	for _, w := range words {
-		r, err := regexp.Compile("(.*\\W|^)" + w + "(\\W.*|$)")
-		if err != nil {
-			log.Println("Cant compile expression for filter word: " + w)
+//Rebuild compiles the ban lists and replaces the current ones.
+//Searches running while the lists are rebuilt use the previous lists.
+func (m *Matcher) Rebuild(lists []MatchList, log *log.Logger) {
+	d := &matcherData{automata: make(map[string]*ahoCorasick), patterns: make(map[string][]matcherPattern)}
+	for i, l := range lists {
+		if l.Normalization == "" {
+			l.Normalization = NormalizeStandard
+		}
+		if !ExistsInSlice(l.Normalization, d.levels) {
+			d.levels = append(d.levels, l.Normalization)
+		}
+		for _, w := range l.Words {
+			switch l.Entries {
+			case EntryRegex, EntryWildcard:
+				expr := w
+				if l.Entries == EntryWildcard {
+					expr = wildcardExpression(w, l.Normalization)
+				} else if l.Normalization != NormalizeNone {
+					expr = "(?i)" + expr
+				}
+				r, err := regexp.Compile("(?:^|\\W)(?:" + expr + ")(?:\\W|$)")
+				if err != nil {
+					log.Println("Cant compile expression for filter word: " + w)
+					continue
+				}
+				d.rgxps = append(d.rgxps, matcherRegexp{list: i, term: w, level: l.Normalization, rgxp: r})
+			default:
+				n := Normalize(w, l.Normalization)
+				if n == "" {
+					continue
+				}
+				d.patterns[l.Normalization] = append(d.patterns[l.Normalization], matcherPattern{list: i, term: n})
+			}
+		}
+	}
+	for level, p := range d.patterns {
+		terms := make([]string, len(p))
+		for i := range p {
+			terms[i] = p[i].term
+		}
+		d.automata[level] = newAhoCorasick(terms)
+	}
+	m.current.Store(d)
+}
+
+//wildcardExpression normalizes the text between the wildcards and replaces
+//* with any number of letters and ? with a single letter.
+func wildcardExpression(w string, level string) string {
+	var b strings.Builder
+	seg := ""
+	for _, r := range w {
+		if r != '*' && r != '?' {
+			seg += string(r)
+			continue
+		}
+		b.WriteString(regexp.QuoteMeta(Normalize(seg, level)))
+		seg = ""
+		if r == '*' {
+			b.WriteString("\\w*")
 		} else {
-			m.rgxp = append(m.rgxp, r)
+			b.WriteString("\\w")
 		}
 	}
-	return m
+	b.WriteString(regexp.QuoteMeta(Normalize(seg, level)))
+	return b.String()
 }
 
-func (m *Matcher) Match(s string) bool {
-	for i := range m.rgxp {
-		if m.rgxp[i].MatchString(s) {
-			return true
+//Match normalizes the message and returns the first list, in the order the lists were provided,
+//that has a term in the message. The terms must be surrounded by non word characters.
+func (m *Matcher) Match(s string) (MatchResult, bool) {
+	d, _ := m.current.Load().(*matcherData)
+	if d == nil {
+		return MatchResult{}, false
+	}
+	best := MatchResult{List: -1}
+	normalized := make(map[string]string, len(d.levels))
+	for _, level := range d.levels {
+		normalized[level] = Normalize(s, level)
+	}
+	for level, ac := range d.automata {
+		text := normalized[level]
+		p := d.patterns[level]
+		ac.find(text, func(i int, end int) bool {
+			if best.List >= 0 && p[i].list >= best.List {
+				return true
+			}
+			if isBoundary(text, end-len(p[i].term)-1) && isBoundary(text, end) {
+				best = MatchResult{List: p[i].list, Term: p[i].term}
+			}
+			return best.List != 0
+		})
+	}
+	for _, r := range d.rgxps {
+		if best.List >= 0 && r.list >= best.List {
+			continue
 		}
+		if r.rgxp.MatchString(normalized[r.level]) {
+			best = MatchResult{List: r.list, Term: r.term}
+		}
+	}
+	return best, best.List >= 0
+}
+
+//isBoundary returns true if the position is outside of the text or it is not a word character,
+//the same as \W in a regular expression.
+func isBoundary(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return true
 	}
-	return false
+	c := s[i]
+	return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_')
 }
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var messages = []string{
+	"hello everyone how is the stream going today",
+	"that was an amazing play, gg",
+	"can you play the next level with the fire sword please",
+	"lol this boss is impossible",
+	"first time here, love the channel",
+}
+
+//regexpMatcher is the previous implementation of the matcher, one regular expression per word.
+type regexpMatcher struct {
+	rgxp []*regexp.Regexp
+}
+
+func newRegexpMatcher(words []string) regexpMatcher {
+	m := regexpMatcher{}
+	for _, w := range words {
+		m.rgxp = append(m.rgxp, regexp.MustCompile("(.*\\W|^)"+w+"(\\W.*|$)"))
+	}
+	return m
+}
+
+func (m *regexpMatcher) match(s string) bool {
+	for i := range m.rgxp {
+		if m.rgxp[i].MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func randomWords(n int) []string {
+	r := rand.New(rand.NewSource(42))
+	words := make([]string, n)
+	for i := range words {
+		b := make([]byte, 4+r.Intn(6))
+		for j := range b {
+			b[j] = byte('a' + r.Intn(26))
+		}
+		words[i] = string(b)
+	}
+	return words
+}
+
+func TestMatcherAgreesWithRegexp(t *testing.T) {
+	words := append(randomWords(500), "boss", "fire sword")
+	m := NewMatcher([]MatchList{{Words: words, Normalization: NormalizeCase}}, log.New(ioutil.Discard, "", 0))
+	r := newRegexpMatcher(words)
+	for _, s := range append(messages, "bossy", "the firesword", "BOSS!") {
+		_, found := m.Match(s)
+		if found != r.match(Normalize(s, NormalizeCase)) {
+			t.Errorf("Matcher and regexp disagree for [%s]", s)
+		}
+	}
+}
+
+func TestMatcherReportsFirstList(t *testing.T) {
+	lists := []MatchList{
+		{Words: []string{"spoiler"}},
+		{Words: []string{"boss", "spoiler"}},
+		{Words: []string{"sw*d"}, Entries: EntryWildcard},
+	}
+	m := NewMatcher(lists, log.New(ioutil.Discard, "", 0))
+	cases := map[string]int{"the BOSS is here": 1, "no spoiler please": 0, "nice sword": 2, "nothing": -1}
+	for s, list := range cases {
+		res, found := m.Match(s)
+		if !found {
+			res.List = -1
+		}
+		if res.List != list {
+			t.Errorf("Expected list %d for [%s], got %d", list, s, res.List)
+		}
+	}
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	for _, n := range []int{10, 1000, 5000} {
+		words := randomWords(n)
+		b.Run("regexp/"+strconv.Itoa(n), func(b *testing.B) {
+			m := newRegexpMatcher(words)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.match(messages[i%len(messages)])
+			}
+		})
+		b.Run("ahocorasick/"+strconv.Itoa(n), func(b *testing.B) {
+			m := NewMatcher([]MatchList{{Words: words}}, log.New(ioutil.Discard, "", 0))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.Match(messages[i%len(messages)])
+			}
+		})
+	}
+}
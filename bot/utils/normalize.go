@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+//Normalization levels of a ban list, every level includes the steps of the previous ones.
+const (
+	//The message is used as it is
+	NormalizeNone = "none"
+	//Case folding
+	NormalizeCase = "case"
+	//Accent stripping, look alike characters and extra spaces
+	NormalizeStandard = "standard"
+	//Leet substitution, punctuation and spaces between letters and repeated characters
+	NormalizeStrict = "strict"
+)
+
+//Base letter of the accented latin characters.
+var accents = map[rune]rune{}
+
+func init() {
+	table := map[rune]string{
+		'a': "àáâãäåāăąǎǻ",
+		'c': "çćĉċč",
+		'd': "ďđ",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭįıǐ",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀł",
+		'n': "ñńņňŉ",
+		'o': "òóôõöøōŏőǒǿ",
+		'r': "ŕŗř",
+		's': "śŝşšș",
+		't': "ţťŧț",
+		'u': "ùúûüũūŭůűųǔǖǘǚǜ",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	}
+	for base, s := range table {
+		for _, r := range s {
+			accents[r] = base
+		}
+	}
+}
+
+//Latin letters with the same shape as cyrillic and greek characters, in lower case.
+var homoglyphs = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c',
+	'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ї': 'i', 'ј': 'j', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'ɡ': 'g', 'ı': 'i', 'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w', 'ꞵ': 'b',
+}
+
+//Characters commonly used in place of letters.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't', '€': 'e',
+}
+
+//ValidNormalization returns true if the level is empty or one of the normalization levels.
+func ValidNormalization(level string) bool {
+	return level == "" || ExistsInSlice(level, []string{NormalizeNone, NormalizeCase, NormalizeStandard, NormalizeStrict})
+}
+
+//Normalize transforms the text according to the level so obfuscated words can be matched.
+//An empty level is the same as NormalizeStandard.
+func Normalize(s string, level string) string {
+	if level == NormalizeNone {
+		return s
+	}
+	s = strings.ToLower(s)
+	if level == NormalizeCase {
+		return s
+	}
+	strict := level == NormalizeStrict
+	var b strings.Builder
+	for _, r := range s {
+		r = foldRune(r)
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if strict {
+			if l, ok := leet[r]; ok {
+				r = l
+			} else if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				r = ' '
+			}
+		}
+		b.WriteRune(r)
+	}
+	words := strings.Fields(b.String())
+	if strict {
+		words = joinLetters(words)
+		for i := range words {
+			words[i] = collapseRepeated(words[i])
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+//foldRune maps full width, mathematical, circled, accented and look alike characters to plain latin letters.
+func foldRune(r rune) rune {
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E:
+		r = unicode.ToLower(r - 0xFF01 + '!')
+	case r >= 0x1D400 && r <= 0x1D6A3:
+		r = rune('a' + (r-0x1D400)%52%26)
+	case r >= 0x1D7CE && r <= 0x1D7FF:
+		r = rune('0' + (r-0x1D7CE)%10)
+	case r >= 0x24B6 && r <= 0x24E9:
+		r = rune('a' + (r-0x24B6)%26)
+	}
+	if a, ok := accents[r]; ok {
+		return a
+	}
+	if h, ok := homoglyphs[r]; ok {
+		return h
+	}
+	return r
+}
+
+//joinLetters joins the runs of words of a single character, "b a d" becomes "bad".
+func joinLetters(words []string) []string {
+	var res []string
+	run := ""
+	for _, w := range words {
+		if len([]rune(w)) == 1 {
+			run += w
+			continue
+		}
+		if run != "" {
+			res = append(res, run)
+			run = ""
+		}
+		res = append(res, w)
+	}
+	if run != "" {
+		res = append(res, run)
+	}
+	return res
+}
+
+//collapseRepeated replaces the runs of the same character with a single one.
+func collapseRepeated(w string) string {
+	var b strings.Builder
+	var last rune = -1
+	for _, r := range w {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in    string
+		level string
+		want  string
+	}{
+		{"HeLLo  Wörld", NormalizeNone, "HeLLo  Wörld"},
+		{"HeLLo Wörld", NormalizeCase, "hello wörld"},
+		{"Héllo   Wörld ", NormalizeStandard, "hello world"},
+		{"Héllo", "", "hello"},
+		{"é", NormalizeStandard, "e"},
+		{"рауpal", NormalizeStandard, "paypal"},
+		{"ＢＡＤ", NormalizeStandard, "bad"},
+		{"ⓑⓐⓓ", NormalizeStandard, "bad"},
+		{"b4d", NormalizeStandard, "b4d"},
+		{"b4d", NormalizeStrict, "bad"},
+		{"sh!t", NormalizeStrict, "shit"},
+		{"b a d word", NormalizeStrict, "bad word"},
+		{"b.a.d", NormalizeStrict, "bad"},
+		{"baaaad", NormalizeStrict, "bad"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in, tt.level); got != tt.want {
+			t.Errorf("Normalize(%q, %q) = %q, want %q", tt.in, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestValidNormalization(t *testing.T) {
+	tests := []struct {
+		level string
+		want  bool
+	}{
+		{"", true},
+		{NormalizeNone, true},
+		{NormalizeCase, true},
+		{NormalizeStandard, true},
+		{NormalizeStrict, true},
+		{"leet", false},
+	}
+	for _, tt := range tests {
+		if got := ValidNormalization(tt.level); got != tt.want {
+			t.Errorf("ValidNormalization(%q) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
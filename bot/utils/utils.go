@@ -10,9 +10,12 @@ const (
 	Version = "3.1.0"
 )
 
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
 var actions = []string{"response"}
 var penalties = []string{"temporary", "permanent", ""}
-var username = make(map[string]string)
 
 //ValidateResponseType returns true if the parameter t is one of the valid action types.
 //Returns false otherwise.
@@ -32,20 +35,12 @@ func ExistsInSlice(s string, sl []string) bool {
 	return false
 }
 
-//AddToUsers adds the userId and name of a user to the username table.
-func AddToUsers(userId string, name string) {
-	username[userId] = name
-}
-
-//GetUserName looks for the userId name in the username table.
-//Uses time.Now().Unix() as seed.
-func GetUserName(userId string) string {
-	return username[userId]
-}
-
 //GetRandomElement returns a random element from the provided slice.
+//Returns an empty string if the slice is empty.
 func GetRandomElement(s []string) string {
-	rand.Seed(time.Now().Unix())
+	if len(s) == 0 {
+		return ""
+	}
 	return s[rand.Intn(len(s))]
 }
 
@@ -53,8 +53,18 @@ type PageInfo struct {
 }
 
 type MessageItem struct {
-	Snippet MessageSnippet `json:"snippet"`
-	Id      string         `json:"id"`
+	Snippet       MessageSnippet `json:"snippet"`
+	AuthorDetails AuthorDetails  `json:"authorDetails"`
+	Id            string         `json:"id"`
+}
+
+type AuthorDetails struct {
+	ChannelId       string `json:"channelId"`
+	DisplayName     string `json:"displayName"`
+	IsVerified      bool   `json:"isVerified"`
+	IsChatOwner     bool   `json:"isChatOwner"`
+	IsChatSponsor   bool   `json:"isChatSponsor"`
+	IsChatModerator bool   `json:"isChatModerator"`
 }
 
 type MessageSnippet struct {
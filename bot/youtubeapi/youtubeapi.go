@@ -21,15 +21,26 @@ var ErrorNotFound error = errors.New("Resource not found.")
 var ErrorNilCommentID error = errors.New("Comment Id not provided")
 var ErrorEncoding error = errors.New("Error encoding data.")
 var ErrUnauthorized error = errors.New("Unauthorized, invalid credentials")
+var ErrorNilBanID error = errors.New("Ban Id not provided")
+
+//Estimated quota units used by each call of the YouTube Data API.
+const (
+	QuotaSearch       = 100
+	QuotaList         = 1
+	QuotaReadMessages = 5
+	QuotaInsert       = 50
+	QuotaDelete       = 50
+)
 
 const (
 	urlLivestreamFromChannel = "https://www.googleapis.com/youtube/v3/search?part=snippet&channelId=#UID&eventType=live&type=video&key="
 	urlLiveChatId            = "https://www.googleapis.com/youtube/v3/videos?part=liveStreamingDetails&id=#UID&key="
 	urlPostComment           = "https://www.googleapis.com/youtube/v3/liveChat/messages?part=snippet&key="
-	urlGetMessages           = "https://www.googleapis.com/youtube/v3/liveChat/messages?liveChatId=#UID&part=snippet&key="
+	urlGetMessages           = "https://www.googleapis.com/youtube/v3/liveChat/messages?liveChatId=#UID&part=snippet,authorDetails&key="
 	urlGetUser               = "https://www.googleapis.com/youtube/v3/channels?part=snippet&id=#UID&key="
 	urlDeleteComment         = "https://www.googleapis.com/youtube/v3/liveChat/messages?id=#UID&key="
 	urlBanUser               = "https://www.googleapis.com/youtube/v3/liveChat/bans?part=snippet&key="
+	urlUnbanUser             = "https://www.googleapis.com/youtube/v3/liveChat/bans?id=#UID&key="
 	urlOauth                 = "https://oauth2.googleapis.com/token?"
 	pageToken                = "&pageToken="
 	client_id                = "client_id="
@@ -92,24 +103,34 @@ func GetLiveChatIdFromLiveStreamId(s string, key string, l *log.Logger) (string,
 		l.Println(errD.Error())
 		return "", ErrorDecoding
 	}
+	if details == nil || len(details.Items) == 0 {
+		l.Println("The live stream was not found.")
+		return "", ErrorNotFound
+	}
 	return details.Items[0].Details.LiveChatId, nil
 
 }
 
 func GetFristLiveChatIdFromChannelId(c string, key string, l *log.Logger) (string, error) {
+	_, liveChatId, err := GetFirstLiveStreamFromChannelId(c, key, l)
+	return liveChatId, err
+}
+
+//GetFirstLiveStreamFromChannelId returns the video id and the live chat id of the first active live stream of the channel.
+func GetFirstLiveStreamFromChannelId(c string, key string, l *log.Logger) (string, string, error) {
 	ids, err := GetLivestreamIdFromChannelId(c, key, l)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	if len(ids) < 1 {
 		l.Println(ErrorNoActiveLivestreams.Error())
-		return "", ErrorNoActiveLivestreams
+		return "", "", ErrorNoActiveLivestreams
 	}
-	liveChatId, err2 := GetLiveChatIdFromLiveStreamId(ids[0], key, l)
-	if err2 != nil {
-		return "", err
+	liveChatId, err := GetLiveChatIdFromLiveStreamId(ids[0], key, l)
+	if err != nil {
+		return "", "", err
 	}
-	return liveChatId, nil
+	return ids[0], liveChatId, nil
 }
 
 func PostComment(message string, chatId string, author string, key string, token string, l *log.Logger) error {
@@ -240,23 +261,43 @@ func BanUser(chatId string, t string, userId string, d int, key string, token st
 	return ban.Id, nil
 }
 
+func UnbanUser(banId string, key string, token string, l *log.Logger) error {
+	if banId == "" {
+		l.Println(ErrorNilBanID.Error())
+		return ErrorNilBanID
+	}
+	if key == "" {
+		l.Println(ErrorNoApiKey.Error())
+		return ErrorNoApiKey
+	}
+	urlDelete := urlUnbanUser + url.QueryEscape(key)
+	urlDelete = strings.Replace(urlDelete, "#UID", url.QueryEscape(banId), 1)
+	return doDeleteWithOauth2(urlDelete, token, l)
+}
+
 func GetNewAuthToken(cId string, cSec string, ref string, l *log.Logger) (string, error) {
+	token, err := RequestAuthToken(cId, cSec, ref, l)
+	return token.Token, err
+}
+
+//RequestAuthToken obtains a new oauth token with the refresh token, the response includes its expiration in seconds.
+func RequestAuthToken(cId string, cSec string, ref string, l *log.Logger) (TokenResponse, error) {
 	if cId == "" || cSec == "" || ref == "" {
-		return "", errors.New("Error missing data needed for new token.")
+		return TokenResponse{}, errors.New("Error missing data needed for new token.")
 	}
 	urlPost := urlOauth + client_id + url.QueryEscape(cId) + "&" + client_secret + url.QueryEscape(cSec) + "&" + refresh_token + url.QueryEscape(ref) + "&" + grant_type
 	res, err := doPost(urlPost, make([]byte, 0), nil, l)
 	if err != nil {
-		return "", err
+		return TokenResponse{}, err
 	}
 	defer res.Body.Close()
 	var token TokenResponse
 	errD := json.NewDecoder(res.Body).Decode(&token)
 	if errD != nil {
 		l.Println(errD.Error())
-		return "", ErrorDecoding
+		return TokenResponse{}, ErrorDecoding
 	}
-	return token.Token, nil
+	return token, nil
 }
 
 func doGet(u string, l *log.Logger) (*http.Response, error) {